@@ -1,44 +1,111 @@
 package traefik_fallback_plugin
 
 import (
+	"container/list"
+	"net/http"
 	"sync"
 	"time"
 )
 
+// defaultCacheMaxEntries bounds DefaultCache, whose keys may be derived from
+// client controlled request paths, queries and headers.
+const defaultCacheMaxEntries = 1000
+
 type CacheRecord struct {
 	Body        []byte
 	ContentType string
-	ExpiresAt   time.Time
+	// StatusCode is the fallback origin status, 0 when not fetched over HTTP.
+	StatusCode int
+	// Header holds the subset of the fallback origin headers that is replayed
+	// on fallback responses.
+	Header    http.Header
+	ExpiresAt time.Time
+	ModTime   time.Time
+	// Stale is set on expired records served because refreshing them failed.
+	Stale bool
+	// RetryAt is when a stale record is refreshed again, until then it is
+	// served without contacting the failing origin.
+	RetryAt time.Time
 }
 
 func (c *CacheRecord) IsExpired() bool {
 	return time.Now().After(c.ExpiresAt)
 }
 
+func (c *CacheRecord) isBackingOff() bool {
+	return c.Stale && time.Now().Before(c.RetryAt)
+}
+
+type cacheEntry struct {
+	key    string
+	record *CacheRecord
+}
+
+// DefaultCache is an in-memory cache evicting the least recently used record
+// once it holds maxEntries records.
 type DefaultCache struct {
-	cache *sync.Map
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List
+	maxEntries int
 }
 
 func NewDefaultCache() *DefaultCache {
+	return NewDefaultCacheWithLimit(defaultCacheMaxEntries)
+}
+
+// NewDefaultCacheWithLimit creates a cache holding at most maxEntries records,
+// a non-positive limit falls back to the default one.
+func NewDefaultCacheWithLimit(maxEntries int) *DefaultCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
 	return &DefaultCache{
-		cache: &sync.Map{},
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		maxEntries: maxEntries,
 	}
 }
 
 func (c *DefaultCache) Load(key string) (*CacheRecord, bool) {
-	rec, ok := c.cache.Load(key)
-	if !ok {
-		return nil, false
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	converted, ok := rec.(*CacheRecord)
+	elem, ok := c.entries[key]
 	if !ok {
 		return nil, false
 	}
 
-	return converted, ok
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).record, true
 }
 
 func (c *DefaultCache) Store(key string, value *CacheRecord) {
-	c.cache.Store(key, value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).record = value
+		c.order.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, record: value})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of cached records.
+func (c *DefaultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
 }
@@ -0,0 +1,110 @@
+package traefik_fallback_plugin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDeltaSeconds caps delta-seconds values such as max-age, larger values
+// are treated as this value, see RFC 9111 section 1.2.2.
+const maxDeltaSeconds = 1 << 31
+
+// cacheControlDirectives parses the Cache-Control header into lower cased
+// directive names and their unquoted values.
+func cacheControlDirectives(header http.Header) map[string]string {
+	directives := map[string]string{}
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+
+			directives[strings.ToLower(name)] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+
+	return directives
+}
+
+// isNoStore reports whether the origin forbids caching the response.
+func isNoStore(header http.Header) bool {
+	_, ok := cacheControlDirectives(header)["no-store"]
+
+	return ok
+}
+
+// originTTL returns the freshness lifetime announced by the origin and whether
+// it announced one. s-maxage takes precedence over max-age, which takes
+// precedence over Expires, see RFC 9111 section 4.2.1.
+func originTTL(header http.Header, now time.Time) (time.Duration, bool) {
+	directives := cacheControlDirectives(header)
+
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[name]
+		if !ok {
+			continue
+		}
+
+		seconds, ok := parseDeltaSeconds(value)
+		if !ok {
+			return 0, true
+		}
+
+		return seconds - age(header), true
+	}
+
+	expires := header.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+
+	expiresAt, err := http.ParseTime(expires)
+	if err != nil { // invalid dates, e.g. "0", mean already expired
+		return 0, true
+	}
+
+	if date, dateErr := http.ParseTime(header.Get("Date")); dateErr == nil {
+		now = date // measure against the origin clock
+	}
+
+	return expiresAt.Sub(now) - age(header), true
+}
+
+// age returns the time the response already spent in upstream caches.
+func age(header http.Header) time.Duration {
+	seconds, ok := parseDeltaSeconds(strings.TrimSpace(header.Get("Age")))
+	if !ok {
+		return 0
+	}
+
+	return seconds
+}
+
+// parseDeltaSeconds parses a non-negative number of seconds, capping values
+// that would overflow at maxDeltaSeconds.
+func parseDeltaSeconds(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds > maxDeltaSeconds { // only overflows remain
+		seconds = maxDeltaSeconds
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
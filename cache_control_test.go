@@ -0,0 +1,312 @@
+package traefik_fallback_plugin_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestFetcherOriginCacheControl(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name     string
+		header   http.Header
+		minTTL   time.Duration
+		maxTTL   time.Duration
+		expected time.Duration
+		stored   bool
+	}{
+		{
+			name:     "no freshness information",
+			header:   http.Header{},
+			expected: time.Minute,
+			stored:   true,
+		},
+		{
+			name:     "max-age",
+			header:   http.Header{"Cache-Control": {"public, max-age=300"}},
+			expected: 5 * time.Minute,
+			stored:   true,
+		},
+		{
+			name:     "s-maxage wins over max-age",
+			header:   http.Header{"Cache-Control": {"max-age=300, s-maxage=600"}},
+			expected: 10 * time.Minute,
+			stored:   true,
+		},
+		{
+			name:     "age is subtracted",
+			header:   http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}},
+			expected: 200 * time.Second,
+			stored:   true,
+		},
+		{
+			name:     "max-age wins over expires",
+			header:   http.Header{"Cache-Control": {"max-age=300"}, "Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)}},
+			expected: 5 * time.Minute,
+			stored:   true,
+		},
+		{
+			name: "expires relative to date",
+			header: http.Header{
+				"Date":    {now.Add(-time.Hour).UTC().Format(http.TimeFormat)},
+				"Expires": {now.UTC().Format(http.TimeFormat)},
+			},
+			expected: time.Hour,
+			stored:   true,
+		},
+		{
+			name:     "invalid expires",
+			header:   http.Header{"Expires": {"0"}},
+			expected: 0,
+			stored:   true,
+		},
+		{
+			name:     "no-cache",
+			header:   http.Header{"Cache-Control": {"no-cache"}},
+			expected: 0,
+			stored:   true,
+		},
+		{
+			name:     "clamped to min",
+			header:   http.Header{"Cache-Control": {"max-age=1"}},
+			minTTL:   30 * time.Second,
+			expected: 30 * time.Second,
+			stored:   true,
+		},
+		{
+			name:     "clamped to max",
+			header:   http.Header{"Cache-Control": {"max-age=86400"}},
+			maxTTL:   time.Hour,
+			expected: time.Hour,
+			stored:   true,
+		},
+		{
+			name:     "overflowing max-age is capped",
+			header:   http.Header{"Cache-Control": {"max-age=99999999999999999999"}},
+			expected: (1 << 31) * time.Second,
+			stored:   true,
+		},
+		{
+			name:     "overflowing max-age clamped to max",
+			header:   http.Header{"Cache-Control": {"max-age=9223372036854775807"}},
+			maxTTL:   time.Hour,
+			expected: time.Hour,
+			stored:   true,
+		},
+		{
+			name:   "no-store",
+			header: http.Header{"Cache-Control": {"No-Store"}},
+			minTTL: time.Minute,
+			stored: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			transport := NewMockTransport(gomock.NewController(t))
+			cache := traefik_fallback_plugin.NewDefaultCache()
+
+			transport.EXPECT().RoundTrip(gomock.Any()).
+				Return(&http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        c.header,
+					Body:          io.NopCloser(bytes.NewBufferString("ok")),
+					ContentLength: 2,
+				}, nil)
+
+			fc := traefik_fallback_plugin.NewHttpFetcher(
+				&http.Client{Transport: transport},
+				cache,
+				"http://example.com/index.html",
+				time.Minute,
+				5*time.Second,
+				traefik_fallback_plugin.WithOriginCacheControl(c.minTTL, c.maxTTL))
+
+			record, err := fc.Fetch(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "ok", string(record.Body))
+
+			_, ok := cache.Load("http://example.com/index.html")
+			assert.Equal(t, c.stored, ok)
+
+			if c.stored {
+				assert.WithinDuration(t, time.Now().Add(c.expected), record.ExpiresAt, 2*time.Second)
+			}
+		})
+	}
+}
+
+func TestFetcherIgnoresOriginCacheControlByDefault(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Cache-Control": {"no-store, max-age=0"}},
+			Body:          io.NopCloser(bytes.NewBufferString("ok")),
+			ContentLength: 2,
+		}, nil)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		time.Minute,
+		5*time.Second)
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), record.ExpiresAt, 2*time.Second)
+
+	_, ok := cache.Load("http://example.com/index.html")
+	assert.True(t, ok)
+}
+
+func TestFetcherOriginCacheControlOnRevalidation(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		Header:    http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60"}},
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode: http.StatusNotModified,
+			Header:     http.Header{"Cache-Control": {"max-age=600"}},
+			Body:       io.NopCloser(bytes.NewBufferString("")),
+		}, nil)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		time.Minute,
+		5*time.Second,
+		traefik_fallback_plugin.WithOriginCacheControl(0, 0))
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "old", string(record.Body))
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), record.ExpiresAt, 2*time.Second)
+}
+
+func TestNewFallbackInvalidCacheTTLBounds(t *testing.T) {
+	for _, config := range []*traefik_fallback_plugin.Config{
+		{MinCacheTTL: "abc"},
+		{MinCacheTTL: "-1s"},
+		{MaxCacheTTL: "abc"},
+		{MaxCacheTTL: "-1s"},
+		{MinCacheTTL: "1h", MaxCacheTTL: "1m"},
+	} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), config, "test")
+
+		assert.Error(t, err, config)
+	}
+}
+
+func TestFallbackHonorCacheControl(t *testing.T) {
+	var hits int32
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("maintenance"))
+	}))
+	defer origin.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	for honor, expected := range map[bool]int32{false: 1, true: 3} {
+		atomic.StoreInt32(&hits, 0)
+
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "502",
+			FallbackURL:           origin.URL,
+			HonorCacheControl:     honor,
+		}, "test")
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			rec := httptest.NewRecorder()
+			fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, "maintenance", rec.Body.String())
+		}
+
+		assert.EqualValues(t, expected, atomic.LoadInt32(&hits), honor)
+	}
+}
+
+func TestFetcherOriginCacheControlOnRevalidationUsesAgeAndDate(t *testing.T) {
+	now := time.Now()
+
+	for name, c := range map[string]struct {
+		stored   http.Header
+		response http.Header
+		expected time.Duration
+	}{
+		"age": {
+			stored:   http.Header{"Etag": {`"v1"`}},
+			response: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"100"}},
+			expected: 500 * time.Second,
+		},
+		"date": {
+			stored: http.Header{
+				"Etag":    {`"v1"`},
+				"Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)},
+			},
+			response: http.Header{"Date": {now.Add(-time.Hour).UTC().Format(http.TimeFormat)}},
+			expected: 2 * time.Hour,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			transport := NewMockTransport(gomock.NewController(t))
+			cache := traefik_fallback_plugin.NewDefaultCache()
+
+			cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+				Body:      []byte("old"),
+				Header:    c.stored,
+				ExpiresAt: time.Now().Add(-time.Second),
+			})
+
+			transport.EXPECT().RoundTrip(gomock.Any()).
+				Return(&http.Response{
+					StatusCode: http.StatusNotModified,
+					Header:     c.response,
+					Body:       io.NopCloser(bytes.NewBufferString("")),
+				}, nil)
+
+			fc := traefik_fallback_plugin.NewHttpFetcher(
+				&http.Client{Transport: transport},
+				cache,
+				"http://example.com/index.html",
+				time.Minute,
+				5*time.Second,
+				traefik_fallback_plugin.WithOriginCacheControl(0, 0))
+
+			record, err := fc.Fetch(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "old", string(record.Body))
+			assert.WithinDuration(t, time.Now().Add(c.expected), record.ExpiresAt, 2*time.Second)
+			assert.Empty(t, record.Header.Get("Age")) // not replayed to clients
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type cacheKeySegment struct {
+	literal string
+	name    string
+	arg     string
+}
+
+// CacheKeyTemplate renders cache keys from the request a fallback is served
+// for. Supported placeholders are {method}, {host}, {path}, {query},
+// {query:name}, {header:Name} and {contentType}, the negotiated content type.
+type CacheKeyTemplate struct {
+	segments []cacheKeySegment
+}
+
+func ParseCacheKeyTemplate(tmpl string) (*CacheKeyTemplate, error) {
+	t := &CacheKeyTemplate{}
+	rest := tmpl
+
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			t.segments = append(t.segments, cacheKeySegment{literal: rest})
+			break
+		}
+
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("invalid cache key template %q: unexpected }", tmpl)
+		}
+
+		if start > 0 {
+			t.segments = append(t.segments, cacheKeySegment{literal: rest[:start]})
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid cache key template %q: unclosed {", tmpl)
+		}
+
+		placeholder := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+
+		name, arg, _ := strings.Cut(placeholder, ":")
+
+		switch name {
+		case "method", "host", "path", "contentType":
+			if arg != "" {
+				return nil, fmt.Errorf("invalid cache key template %q: {%s} takes no argument", tmpl, name)
+			}
+		case "query":
+		case "header":
+			if arg == "" {
+				return nil, fmt.Errorf("invalid cache key template %q: {header} requires a header name", tmpl)
+			}
+
+			arg = http.CanonicalHeaderKey(arg)
+		default:
+			return nil, fmt.Errorf("invalid cache key template %q: unknown placeholder {%s}", tmpl, placeholder)
+		}
+
+		t.segments = append(t.segments, cacheKeySegment{name: name, arg: arg})
+	}
+
+	return t, nil
+}
+
+func (t *CacheKeyTemplate) Render(req *FetchRequest) string {
+	var sb strings.Builder
+
+	var original *http.Request
+	if req != nil {
+		original = req.Request
+	}
+
+	for _, segment := range t.segments {
+		if segment.name == "" {
+			sb.WriteString(segment.literal)
+			continue
+		}
+
+		if segment.name == "contentType" {
+			if req != nil {
+				sb.WriteString(req.ContentType)
+			}
+
+			continue
+		}
+
+		if original == nil {
+			continue
+		}
+
+		switch segment.name {
+		case "method":
+			sb.WriteString(original.Method)
+		case "host":
+			sb.WriteString(requestHost(original))
+		case "path":
+			sb.WriteString(original.URL.EscapedPath())
+		case "query":
+			if segment.arg == "" {
+				sb.WriteString(original.URL.RawQuery)
+			} else {
+				sb.WriteString(strings.Join(original.URL.Query()[segment.arg], ","))
+			}
+		case "header":
+			sb.WriteString(strings.Join(original.Header.Values(segment.arg), ","))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package traefik_fallback_plugin_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestCacheKeyTemplateRender(t *testing.T) {
+	tmpl, err := traefik_fallback_plugin.ParseCacheKeyTemplate(
+		"{method} {host}{path}?{query}|lang={query:lang}|{header:accept-language}|{contentType}",
+	)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://Shop.example.com:8080/a%20b/c?lang=de&lang=en&x=1", nil)
+	req.Header.Add("Accept-Language", "de-DE")
+	req.Header.Add("Accept-Language", "en")
+
+	key := tmpl.Render(&traefik_fallback_plugin.FetchRequest{
+		Request:     req,
+		ContentType: "application/json",
+	})
+
+	assert.Equal(t, "GET shop.example.com/a%20b/c?lang=de&lang=en&x=1|lang=de,en|de-DE,en|application/json", key)
+}
+
+func TestCacheKeyTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{
+		"{path",
+		"path}",
+		"{unknown}",
+		"{header}",
+		"{host:x}",
+	} {
+		_, err := traefik_fallback_plugin.ParseCacheKeyTemplate(tmpl)
+		assert.Error(t, err, tmpl)
+	}
+
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		CacheKeyTemplate: "{nope}",
+	}, "test")
+	assert.Error(t, err)
+}
+
+func TestFetcherCacheKeyTemplate(t *testing.T) {
+	tmpl, err := traefik_fallback_plugin.ParseCacheKeyTemplate("{host}{path}|{query:lang}|{header:X-Tenant}|{contentType}")
+	assert.NoError(t, err)
+
+	transport := NewMockTransport(gomock.NewController(t))
+	calls := 0
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			calls++
+			body := []byte{byte('0' + calls)}
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Body:          io.NopCloser(bytes.NewBuffer(body)),
+				ContentLength: int64(len(body)),
+			}, nil
+		}).AnyTimes()
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		traefik_fallback_plugin.NewDefaultCache(),
+		"http://example.com/index.html",
+		30*time.Second,
+		60*time.Second,
+		traefik_fallback_plugin.WithCacheKeyTemplate(tmpl),
+	)
+
+	fetch := func(target string, tenant string, contentType string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+
+		record, fetchErr := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{
+			Request:     req,
+			ContentType: contentType,
+		})
+		assert.NoError(t, fetchErr)
+
+		return string(record.Body)
+	}
+
+	assert.Equal(t, "1", fetch("http://a.example.com/x?lang=de", "", "text/html"))
+	assert.Equal(t, "2", fetch("http://b.example.com/x?lang=de", "", "text/html"))
+	assert.Equal(t, "3", fetch("http://a.example.com/y?lang=de", "", "text/html"))
+	assert.Equal(t, "4", fetch("http://a.example.com/x?lang=en", "", "text/html"))
+	assert.Equal(t, "5", fetch("http://a.example.com/x?lang=de", "acme", "text/html"))
+	assert.Equal(t, "6", fetch("http://a.example.com/x?lang=de", "", "application/json"))
+
+	// same inputs hit the cache, ignored query params do not matter
+	assert.Equal(t, "1", fetch("http://a.example.com/x?lang=de&utm=1", "", "text/html"))
+	assert.Equal(t, "5", fetch("http://a.example.com/x?lang=de", "acme", "text/html"))
+	assert.Equal(t, 6, calls)
+}
+
+func TestFetcherCacheKeyTemplateWithProxy(t *testing.T) {
+	tmpl, err := traefik_fallback_plugin.ParseCacheKeyTemplate("{header:Accept-Language}")
+	assert.NoError(t, err)
+
+	transport := NewMockTransport(gomock.NewController(t))
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			body := request.URL.Path + " " + request.Header.Get("Accept-Language")
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Body:          io.NopCloser(bytes.NewBufferString(body)),
+				ContentLength: int64(len(body)),
+			}, nil
+		}).Times(3)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		traefik_fallback_plugin.NewDefaultCache(),
+		"http://mirror.internal",
+		30*time.Second,
+		60*time.Second,
+		traefik_fallback_plugin.WithProxy([]string{"Accept-Language"}),
+		traefik_fallback_plugin.WithCacheKeyTemplate(tmpl),
+	)
+
+	fetch := func(path string, lang string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Language", lang)
+
+		record, fetchErr := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+		assert.NoError(t, fetchErr)
+
+		return string(record.Body)
+	}
+
+	assert.Equal(t, "/a de", fetch("/a", "de"))
+	assert.Equal(t, "/b de", fetch("/b", "de"))
+	assert.Equal(t, "/a en", fetch("/a", "en"))
+	assert.Equal(t, "/a de", fetch("/a", "de"))
+	assert.Equal(t, "/b de", fetch("/b", "de"))
+}
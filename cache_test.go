@@ -1,7 +1,12 @@
 package traefik_fallback_plugin_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -27,3 +32,108 @@ func TestDefaultCache(t *testing.T) {
 	assert.False(t, ok)
 	assert.Nil(t, resp)
 }
+
+func TestDefaultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := traefik_fallback_plugin.NewDefaultCacheWithLimit(2)
+
+	c.Store("a", &traefik_fallback_plugin.CacheRecord{Body: []byte("a")})
+	c.Store("b", &traefik_fallback_plugin.CacheRecord{Body: []byte("b")})
+
+	_, ok := c.Load("a") // a is now more recent than b
+	assert.True(t, ok)
+
+	c.Store("c", &traefik_fallback_plugin.CacheRecord{Body: []byte("c")})
+
+	_, ok = c.Load("b")
+	assert.False(t, ok)
+
+	for _, key := range []string{"a", "c"} {
+		rec, found := c.Load(key)
+		assert.True(t, found, key)
+		assert.EqualValues(t, key, string(rec.Body))
+	}
+
+	c.Store("a", &traefik_fallback_plugin.CacheRecord{Body: []byte("a2")})
+
+	rec, ok := c.Load("a")
+	assert.True(t, ok)
+	assert.EqualValues(t, "a2", string(rec.Body))
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestDefaultCacheBoundsProxiedPaths(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("mirror"))
+	}))
+	defer mirror.Close()
+
+	cache := traefik_fallback_plugin.NewDefaultCacheWithLimit(10)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		mirror.Client(),
+		cache,
+		mirror.URL,
+		time.Minute,
+		5*time.Second,
+		traefik_fallback_plugin.WithProxy(nil))
+
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/random?nonce="+strconv.Itoa(i), nil)
+
+		_, err := fc.Fetch(context.Background(), &traefik_fallback_plugin.FetchRequest{Request: req})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 10, cache.Len())
+}
+
+func TestNewFallbackInvalidCacheMaxEntries(t *testing.T) {
+	for _, value := range []string{"abc", "0", "-1"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			CacheMaxEntries: value,
+		}, "test")
+
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFallbackRequestKeysKeepFixedContent(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("maintenance"))
+	}))
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("mirror " + r.URL.Path))
+	}))
+	defer mirror.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		CacheMaxEntries:       "5",
+		Prefetch:              true,
+		Rules: []traefik_fallback_plugin.Rule{
+			{PathPrefix: "/shop", FallbackURL: mirror.URL, FallbackProxy: true},
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	origin.Close()
+
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shop/"+strconv.Itoa(i), nil))
+
+		assert.Equal(t, "mirror /shop/"+strconv.Itoa(i), rec.Body.String())
+	}
+
+	rec := httptest.NewRecorder()
+	fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "maintenance", rec.Body.String())
+}
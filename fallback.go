@@ -5,20 +5,53 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httptest"
+	"runtime/debug"
 	"strconv"
-	"strings"
 	"time"
 )
 
 // Config the plugin configuration.
 type Config struct {
-	FallbackOnStatusCodes string `json:"fallbackOnStatusCodes,omitempty"`
-	FallbackURL           string `json:"fallbackURL,omitempty"`
-	FallbackStatusCode    string `json:"fallbackStatusCode"`
-	FallbackContentType   string `json:"fallbackContentType,omitempty"`
-	UpstreamTimeout       string `json:"upstreamTimeout,omitempty"`
-	CacheTTL              string `json:"cacheTTL,omitempty"`
+	FallbackOnStatusCodes string            `json:"fallbackOnStatusCodes,omitempty"`
+	FallbackURL           string            `json:"fallbackURL,omitempty"`
+	FallbackStatusCode    string            `json:"fallbackStatusCode"`
+	UseOriginStatusCode   bool              `json:"useOriginStatusCode,omitempty"`
+	FallbackContentType   string            `json:"fallbackContentType,omitempty"`
+	FallbackBody          string            `json:"fallbackBody,omitempty"`
+	FallbackBodyBase64    string            `json:"fallbackBodyBase64,omitempty"`
+	FallbackFile          string            `json:"fallbackFile,omitempty"`
+	FallbackDir           string            `json:"fallbackDir,omitempty"`
+	FallbackDirIndex      string            `json:"fallbackDirIndex,omitempty"`
+	FallbackDirSPA        bool              `json:"fallbackDirSPA,omitempty"`
+	FallbackProxy         bool              `json:"fallbackProxy,omitempty"`
+	FallbackProxyHeaders  string            `json:"fallbackProxyHeaders,omitempty"`
+	UpstreamTimeout       string            `json:"upstreamTimeout,omitempty"`
+	CacheTTL              string            `json:"cacheTTL,omitempty"`
+	CacheKeyTemplate      string            `json:"cacheKeyTemplate,omitempty"`
+	CacheMaxEntries       string            `json:"cacheMaxEntries,omitempty"`
+	HonorCacheControl     bool              `json:"honorCacheControl,omitempty"`
+	MinCacheTTL           string            `json:"minCacheTTL,omitempty"`
+	MaxCacheTTL           string            `json:"maxCacheTTL,omitempty"`
+	MaxFallbackBodySize   string            `json:"maxFallbackBodySize,omitempty"`
+	FallbackAcceptStatus  string            `json:"fallbackAcceptStatus,omitempty"`
+	StaleIfError          string            `json:"staleIfError,omitempty"`
+	StaleWhileRevalidate  string            `json:"staleWhileRevalidate,omitempty"`
+	Prefetch              bool              `json:"prefetch,omitempty"`
+	PrefetchRequired      bool              `json:"prefetchRequired,omitempty"`
+	PrefetchInterval      string            `json:"prefetchInterval,omitempty"`
+	FallbackTemplate      string            `json:"fallbackTemplate,omitempty"`
+	RequestIDHeader       string            `json:"requestIDHeader,omitempty"`
+	FallbackHeaders       map[string]string `json:"fallbackHeaders,omitempty"`
+	RetryAfter            string            `json:"retryAfter,omitempty"`
+	MaxBufferedBodySize   string            `json:"maxBufferedBodySize,omitempty"`
+	BufferOverflowAction  string            `json:"bufferOverflowAction,omitempty"`
+	PanicAction           string            `json:"panicAction,omitempty"`
+	LastResortStatusCode  string            `json:"lastResortStatusCode,omitempty"`
+	LastResortContentType string            `json:"lastResortContentType,omitempty"`
+	LastResortHeaders     map[string]string `json:"lastResortHeaders,omitempty"`
+	LastResortBody        string            `json:"lastResortBody,omitempty"`
+	Rules                 []Rule            `json:"rules,omitempty"`
+	Variants              []Variant         `json:"variants,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -30,43 +63,51 @@ func CreateConfig() *Config {
 type Fallback struct {
 	next                http.Handler
 	name                string
-	fallbackCodes       map[int]struct{}
+	fallbackCodes       *StatusMatcher
 	ctx                 context.Context
-	fallbackStatusCode  int
 	timeout             time.Duration
-	fallbackContentType string
-	fetcher             Fetcher
+	cacheTTL            time.Duration
+	cache               Cache
+	requestCache        Cache
+	cacheKeyTemplate    *CacheKeyTemplate
+	honorCacheControl   bool
+	minCacheTTL         time.Duration
+	maxCacheTTL         time.Duration
+	maxFallbackBodySize int64
+	acceptedStatus      *StatusMatcher
+	staleIfError        time.Duration
+	staleRevalidate     time.Duration
+	maxBufferedBodySize int64
+	overflowFallback    bool
+	panicAsError        bool
+	panicHandler        PanicHandler
+	lastResort          *lastResortResponse
+	renderer            *bodyRenderer
+	headers             *responseHeaders
+	useOriginStatusCode bool
+	defaultTarget       *fallbackTarget
+	rules               []*rule
 }
 
 // New created a new Demo plugin.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	statusCodes := map[int]struct{}{}
-	for _, code := range strings.Split(config.FallbackOnStatusCodes, ",") {
-		parsedCode, err := strconv.Atoi(strings.TrimSpace(code))
-		if err != nil {
-			return nil, fmt.Errorf("invalid status code: %s", code)
-		}
-
-		statusCodes[parsedCode] = struct{}{}
+	statusCodes, err := ParseStatusMatcher(config.FallbackOnStatusCodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallbackOnStatusCodes: %w", err)
 	}
 
 	f := &Fallback{
 		next:                next,
 		name:                name,
 		fallbackCodes:       statusCodes,
-		fallbackStatusCode:  http.StatusOK,
 		timeout:             3 * time.Second,
+		cacheTTL:            1 * time.Minute,
+		cache:               NewDefaultCache(),
+		requestCache:        NewDefaultCache(),
+		honorCacheControl:   config.HonorCacheControl,
+		useOriginStatusCode: config.UseOriginStatusCode,
+		panicHandler:        defaultPanicHandler(name),
 		ctx:                 ctx,
-		fallbackContentType: config.FallbackContentType,
-	}
-
-	if config.FallbackStatusCode != "" {
-		statusCode, statusCodeErr := strconv.Atoi(config.FallbackStatusCode)
-		if statusCodeErr != nil {
-			return nil, fmt.Errorf("invalid fallback status code: %s", config.FallbackStatusCode)
-		}
-
-		f.fallbackStatusCode = statusCode
 	}
 
 	if config.UpstreamTimeout != "" {
@@ -78,31 +119,246 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		f.timeout = timeout
 	}
 
-	cacheTTL := 1 * time.Minute
 	if config.CacheTTL != "" {
 		parsedTTL, cacheErr := time.ParseDuration(config.CacheTTL)
 		if cacheErr != nil {
 			return nil, fmt.Errorf("invalid cacheTTL: %s", config.CacheTTL)
 		}
 
-		cacheTTL = parsedTTL
+		f.cacheTTL = parsedTTL
+	}
+
+	if config.CacheMaxEntries != "" {
+		maxEntries, entriesErr := strconv.Atoi(config.CacheMaxEntries)
+		if entriesErr != nil || maxEntries <= 0 {
+			return nil, fmt.Errorf("invalid cacheMaxEntries: %s", config.CacheMaxEntries)
+		}
+
+		f.requestCache = NewDefaultCacheWithLimit(maxEntries)
+	}
+
+	if config.MinCacheTTL != "" {
+		minTTL, ttlErr := time.ParseDuration(config.MinCacheTTL)
+		if ttlErr != nil || minTTL < 0 {
+			return nil, fmt.Errorf("invalid minCacheTTL: %s", config.MinCacheTTL)
+		}
+
+		f.minCacheTTL = minTTL
+	}
+
+	if config.MaxCacheTTL != "" {
+		maxTTL, ttlErr := time.ParseDuration(config.MaxCacheTTL)
+		if ttlErr != nil || maxTTL < 0 || (maxTTL > 0 && maxTTL < f.minCacheTTL) {
+			return nil, fmt.Errorf("invalid maxCacheTTL: %s", config.MaxCacheTTL)
+		}
+
+		f.maxCacheTTL = maxTTL
+	}
+
+	if config.StaleIfError != "" {
+		staleIfError, staleErr := time.ParseDuration(config.StaleIfError)
+		if staleErr != nil || staleIfError < 0 {
+			return nil, fmt.Errorf("invalid staleIfError: %s", config.StaleIfError)
+		}
+
+		f.staleIfError = staleIfError
+	}
+
+	if config.StaleWhileRevalidate != "" {
+		staleRevalidate, staleErr := time.ParseDuration(config.StaleWhileRevalidate)
+		if staleErr != nil || staleRevalidate < 0 {
+			return nil, fmt.Errorf("invalid staleWhileRevalidate: %s", config.StaleWhileRevalidate)
+		}
+
+		f.staleRevalidate = staleRevalidate
+	}
+
+	var prefetchInterval time.Duration
+
+	if config.PrefetchInterval != "" {
+		interval, intervalErr := time.ParseDuration(config.PrefetchInterval)
+		if intervalErr != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid prefetchInterval: %s", config.PrefetchInterval)
+		}
+
+		prefetchInterval = interval
+	}
+
+	if config.MaxBufferedBodySize != "" {
+		maxBuffered, sizeErr := strconv.ParseInt(config.MaxBufferedBodySize, 10, 64)
+		if sizeErr != nil || maxBuffered < 0 {
+			return nil, fmt.Errorf("invalid maxBufferedBodySize: %s", config.MaxBufferedBodySize)
+		}
+
+		f.maxBufferedBodySize = maxBuffered
+	}
+
+	if config.MaxFallbackBodySize != "" {
+		maxSize, sizeErr := strconv.ParseInt(config.MaxFallbackBodySize, 10, 64)
+		if sizeErr != nil || maxSize <= 0 {
+			return nil, fmt.Errorf("invalid maxFallbackBodySize: %s", config.MaxFallbackBodySize)
+		}
+
+		f.maxFallbackBodySize = maxSize
+	}
+
+	// without fallbackAcceptStatus every origin status is cached and served,
+	// e.g. a maintenance page answered with 503
+	f.acceptedStatus, err = ParseStatusMatcher(config.FallbackAcceptStatus)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallbackAcceptStatus: %w", err)
+	}
+
+	switch config.BufferOverflowAction {
+	case "", overflowPassthrough:
+	case overflowFallback:
+		f.overflowFallback = true
+	default:
+		return nil, fmt.Errorf("invalid bufferOverflowAction: %s", config.BufferOverflowAction)
+	}
+
+	switch config.PanicAction {
+	case "", panicActionFallback:
+	case panicActionError:
+		f.panicAsError = true
+	default:
+		return nil, fmt.Errorf("invalid panicAction: %s", config.PanicAction)
+	}
+
+	if config.CacheKeyTemplate != "" {
+		cacheKeyTemplate, templateErr := ParseCacheKeyTemplate(config.CacheKeyTemplate)
+		if templateErr != nil {
+			return nil, templateErr
+		}
+
+		f.cacheKeyTemplate = cacheKeyTemplate
+	}
+
+	renderer, err := newBodyRenderer(config.FallbackTemplate, config.RequestIDHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	f.renderer = renderer
+
+	headers, err := newResponseHeaders(config.FallbackHeaders, config.RetryAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	f.headers = headers
+
+	lastResort, err := newLastResortResponse(config)
+	if err != nil {
+		return nil, err
+	}
+
+	f.lastResort = lastResort
+
+	fetcher, err := f.newFetcher(fetcherSource{
+		url:         config.FallbackURL,
+		body:        config.FallbackBody,
+		bodyBase64:  config.FallbackBodyBase64,
+		file:        config.FallbackFile,
+		dir:         config.FallbackDir,
+		dirIndex:    config.FallbackDirIndex,
+		dirSPA:      config.FallbackDirSPA,
+		proxy:       config.FallbackProxy,
+		proxyHeader: config.FallbackProxyHeaders,
+		contentType: config.FallbackContentType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defaultTarget := &fallbackTarget{
+		fetcher:     fetcher,
+		statusCode:  http.StatusOK,
+		contentType: config.FallbackContentType,
+	}
+
+	if config.FallbackStatusCode != "" {
+		statusCode, statusCodeErr := strconv.Atoi(config.FallbackStatusCode)
+		if statusCodeErr != nil {
+			return nil, fmt.Errorf("invalid fallback status code: %s", config.FallbackStatusCode)
+		}
+
+		defaultTarget.statusCode = statusCode
+	}
+
+	variants, err := f.newVariants(config.Variants, defaultTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultTarget.variants = variants
+	f.defaultTarget = defaultTarget
+
+	for i, ruleConfig := range config.Rules {
+		r, ruleErr := f.newRule(ruleConfig)
+		if ruleErr != nil {
+			return nil, fmt.Errorf("invalid rule %d: %w", i, ruleErr)
+		}
+
+		f.rules = append(f.rules, r)
 	}
 
-	cache := NewDefaultCache()
+	if config.Prefetch || config.PrefetchRequired || prefetchInterval > 0 {
+		prefetchers := f.prefetchers()
+
+		if err = f.prefetch(ctx, prefetchers, config.PrefetchRequired); err != nil {
+			return nil, err
+		}
 
-	f.fetcher = NewHttpFetcher(
-		http.DefaultClient,
-		cache,
-		config.FallbackURL,
-		cacheTTL,
-		f.timeout,
-	)
+		if prefetchInterval > 0 && len(prefetchers) > 0 {
+			go f.refreshPeriodically(ctx, prefetchers, prefetchInterval)
+		}
+	}
 
 	return f, nil
 }
 
+// Upstream panics serve the fallback by default. With panicAction "error" they
+// answer 500, which only serves the fallback when it is a fallback code.
+const (
+	panicActionFallback = "fallback"
+	panicActionError    = "error"
+)
+
+// PanicHandler receives panics recovered from the upstream handler.
+type PanicHandler func(value interface{}, stack []byte)
+
+func defaultPanicHandler(name string) PanicHandler {
+	return func(value interface{}, stack []byte) {
+		log.Printf("[%s] upstream panic: %+v\n%s", name, value, stack)
+	}
+}
+
+// SetPanicHandler replaces the handler notified about upstream panics.
+func (f *Fallback) SetPanicHandler(handler PanicHandler) {
+	f.panicHandler = handler
+}
+
+// SetFetcher replaces the fetcher used when no rule matches the request.
 func (f *Fallback) SetFetcher(fetcher Fetcher) {
-	f.fetcher = fetcher
+	f.defaultTarget.fetcher = fetcher
+}
+
+// resolveTarget returns the target of the first matching rule. The second
+// result reports whether a rule matching on the Accept header was evaluated,
+// making the choice depend on that header.
+func (f *Fallback) resolveTarget(req *http.Request) (*fallbackTarget, bool) {
+	byAccept := false
+
+	for _, r := range f.rules {
+		byAccept = byAccept || r.accept != ""
+
+		if r.matches(req) {
+			return r.target, byAccept
+		}
+	}
+
+	return f.defaultTarget, byAccept
 }
 
 func (f *Fallback) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
@@ -111,66 +367,123 @@ func (f *Fallback) ServeHTTP(writer http.ResponseWriter, request *http.Request)
 
 func (f *Fallback) handler() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if !f.fetcher.CanFetch() || len(f.fallbackCodes) == 0 {
+		resolved, byAccept := f.resolveTarget(req)
+		target, negotiated := resolved.negotiate(req)
+
+		if !target.fetcher.CanFetch() || f.fallbackCodes.IsEmpty() {
 			f.next.ServeHTTP(rw, req)
 			return
 		}
 
-		recorder := httptest.NewRecorder()
+		writer := newUpstreamWriter(rw, f.fallbackCodes.Match, f.maxBufferedBodySize, f.overflowFallback)
+
+		// The upstream only ever sees its own request copy and the writer, so
+		// once abandoned it can keep running without touching the client
+		// response. Cancelling its context asks it to stop early.
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
 
-		ctx, cancel := context.WithTimeout(f.ctx, f.timeout)
-		hasResponse := false
+		upstreamReq := req.WithContext(ctx)
+		done := make(chan struct{})
 
 		go func() {
-			defer cancel()
+			defer close(done)
 			defer func() {
 				if r := recover(); r != nil {
-					log.Printf("panic: %+v", r)
+					writer.recordPanic(r)
+					f.panicHandler(r, debug.Stack())
+
+					if !f.panicAsError {
+						writer.abandon()
+						return
+					}
+
+					writer.WriteHeader(http.StatusInternalServerError)
+					writer.finish()
 				}
 			}()
 
-			req = req.WithContext(ctx)
-			f.next.ServeHTTP(recorder, req)
-			hasResponse = true
+			f.next.ServeHTTP(writer, upstreamReq)
+			writer.finish()
 		}()
 
-		<-ctx.Done()
+		timer := time.NewTimer(f.timeout)
+		defer timer.Stop()
+
+		timedOut := false
+
+		select {
+		case <-writer.decided:
+		case <-done:
+		case <-timer.C:
+			timedOut = true
+		}
 
-		ctx = f.ctx // swap context
+		if writer.abandon() == writerPassthrough {
+			<-done // the response is being streamed to the client
+			return
+		}
 
-		_, ok := f.fallbackCodes[recorder.Code]
+		cancel()
 
-		if !hasResponse || ok { // fallback
-			fallBackData, err := f.fetcher.Fetch(ctx)
+		fetchReq := &FetchRequest{
+			Request:     req,
+			Outcome:     writer.outcome(timedOut),
+			ContentType: target.contentType,
+		}
+
+		fallBackData, err := target.fetcher.Fetch(f.ctx, fetchReq)
+		if err != nil {
+			log.Printf("[%s] fallback fetch failed: %v", f.name, err)
+			f.lastResort.write(rw)
+			return
+		}
+
+		contentType := target.contentType
+		if contentType == "" {
+			contentType = fallBackData.ContentType
+		}
+
+		body := fallBackData.Body
+
+		if f.renderer != nil && body != nil {
+			body, err = f.renderer.render(fallBackData, contentType, fetchReq)
 			if err != nil {
-				rw.WriteHeader(http.StatusTeapot)
-				_, _ = rw.Write([]byte(err.Error()))
+				log.Printf("[%s] fallback template failed: %v", f.name, err)
+				f.lastResort.write(rw)
 				return
 			}
+		}
 
-			rw.WriteHeader(f.fallbackStatusCode)
+		header := rw.Header()
 
-			if f.fallbackContentType != "" {
-				rw.Header().Set("Content-Type", f.fallbackContentType)
-			} else if fallBackData.ContentType != "" {
-				rw.Header().Set("Content-Type", fallBackData.ContentType)
+		for name, values := range fallBackData.Header {
+			if body != nil && f.renderer != nil && isValidatorHeader(name) {
+				continue // validators describe the template, not the rendered body
 			}
 
-			if fallBackData.Body != nil {
-				_, _ = rw.Write(fallBackData.Body)
-			}
+			header[name] = values
+		}
 
-			return
+		f.headers.apply(header, time.Now())
+
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+
+		if negotiated || byAccept {
+			header.Add("Vary", "Accept")
 		}
 
-		for name, values := range recorder.Header() {
-			rw.Header()[name] = values
+		statusCode := target.statusCode
+		if f.useOriginStatusCode && fallBackData.StatusCode != 0 {
+			statusCode = fallBackData.StatusCode
 		}
 
-		rw.WriteHeader(recorder.Code)
+		rw.WriteHeader(statusCode)
 
-		if recorder.Body != nil {
-			_, _ = rw.Write(recorder.Body.Bytes())
+		if body != nil {
+			_, _ = rw.Write(body)
 		}
 	})
 }
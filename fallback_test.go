@@ -124,7 +124,7 @@ func TestPanic(t *testing.T) {
 	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(mockFetcher)
 
 	mockFetcher.EXPECT().CanFetch().Return(true)
-	mockFetcher.EXPECT().Fetch(gomock.Any()).
+	mockFetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).
 		Return(&traefik_fallback_plugin.CacheRecord{
 			Body:        []byte("hello"),
 			ContentType: "application/xx",
@@ -139,6 +139,103 @@ func TestPanic(t *testing.T) {
 	assert.Equal(t, "hello", rec.Body.String())
 }
 
+func TestPanicHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackStatusCode:    "202",
+		FallbackURL:           "https://localhost:123",
+		PanicAction:           "fallback",
+	}, "test")
+	assert.NoError(t, err)
+
+	var panicValue interface{}
+	var panicStack []byte
+
+	mockFetcher := NewMockFetcher(gomock.NewController(t))
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(mockFetcher)
+	fallback.(*traefik_fallback_plugin.Fallback).SetPanicHandler(func(value interface{}, stack []byte) {
+		panicValue = value
+		panicStack = stack
+	})
+
+	mockFetcher.EXPECT().CanFetch().Return(true)
+	mockFetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).
+		Return(&traefik_fallback_plugin.CacheRecord{Body: []byte("hello")}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, "oops", panicValue)
+	assert.Contains(t, string(panicStack), "TestPanicHandler")
+}
+
+func TestNewFallbackInvalidPanicAction(t *testing.T) {
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		PanicAction: "ignore",
+	}, "test")
+	assert.Error(t, err)
+}
+
+func TestPanicActionError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "1")
+		panic("oops")
+	})
+
+	t.Run("treated as internal server error", func(t *testing.T) {
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "502",
+			FallbackURL:           "https://localhost:123",
+			PanicAction:           "error",
+		}, "test")
+		assert.NoError(t, err)
+
+		fallback.(*traefik_fallback_plugin.Fallback).SetPanicHandler(func(value interface{}, stack []byte) {})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("internal server error matches fallback codes", func(t *testing.T) {
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "500",
+			FallbackURL:           "https://localhost:123",
+			PanicAction:           "error",
+		}, "test")
+		assert.NoError(t, err)
+
+		fetcher := NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().CanFetch().Return(true)
+		fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+			Body: []byte("fallback"),
+		}, nil)
+
+		fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+		fallback.(*traefik_fallback_plugin.Fallback).SetPanicHandler(func(value interface{}, stack []byte) {})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "fallback", rec.Body.String())
+	})
+}
+
 func TestFallbackServeHTTPWithFallback(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -155,14 +252,73 @@ func TestFallbackServeHTTPWithFallback(t *testing.T) {
 
 	fetcher := NewMockFetcher(gomock.NewController(t))
 	fetcher.EXPECT().CanFetch().Return(true)
-	fetcher.EXPECT().Fetch(gomock.Any()).Return(nil, errors.New("unexpected err"))
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, errors.New("unexpected err"))
+
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Service Unavailable")
+	assert.NotContains(t, rec.Body.String(), "unexpected err")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+}
+
+func TestFallbackServeHTTPWithConfiguredLastResort(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "500",
+		FallbackURL:           "http://internal.fallback.svc/index.html",
+		LastResortStatusCode:  "502",
+		LastResortContentType: "application/json",
+		LastResortBody:        `{"error":"unavailable"}`,
+		LastResortHeaders: map[string]string{
+			"Cache-Control": "no-store",
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true)
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, errors.New("dial tcp internal.fallback.svc: no such host"))
 
 	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
 	fallback.ServeHTTP(rec, req)
 
-	assert.Equal(t, 418, rec.Code)
-	assert.Equal(t, "unexpected err", rec.Body.String())
-	assert.Equal(t, "", rec.Header().Get("Content-Type"))
+	resp := rec.Result()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, `{"error":"unavailable"}`, rec.Body.String())
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+}
+
+func TestNewFallbackInvalidLastResortStatusCode(t *testing.T) {
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		LastResortStatusCode: "invalid",
+	}, "test")
+
+	assert.Error(t, err)
+
+	for _, code := range []string{"0", "99", "600"} {
+		_, err = traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			LastResortStatusCode: code,
+		}, "test")
+
+		assert.Error(t, err, code)
+	}
+}
+
+func TestNewFallbackLastResortContentTypeWithoutBody(t *testing.T) {
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		LastResortContentType: "application/json",
+	}, "test")
+
+	assert.ErrorContains(t, err, "lastResortContentType requires lastResortBody")
 }
 
 func TestFallbackServeHTTPWithFallbackSuccess(t *testing.T) {
@@ -181,7 +337,7 @@ func TestFallbackServeHTTPWithFallbackSuccess(t *testing.T) {
 
 	fetcher := NewMockFetcher(gomock.NewController(t))
 	fetcher.EXPECT().CanFetch().Return(true)
-	fetcher.EXPECT().Fetch(gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
 		Body:        []byte("content"),
 		ContentType: "ignored",
 	}, nil)
@@ -191,5 +347,321 @@ func TestFallbackServeHTTPWithFallbackSuccess(t *testing.T) {
 
 	assert.Equal(t, 200, rec.Code)
 	assert.Equal(t, "content", rec.Body.String())
-	assert.Equal(t, "application/xx", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "application/xx", rec.Result().Header.Get("Content-Type"))
+}
+
+func TestFallbackServeHTTPReplaysOriginHeaders(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Header().Set("Content-Encoding", "identity")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Set-Cookie", "session=internal")
+		w.Header().Set("X-Internal", "1")
+		_, _ = w.Write([]byte("<h1>down</h1>"))
+	}))
+	defer origin.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "500",
+		FallbackURL:           origin.URL,
+		FallbackHeaders: map[string]string{
+			"Cache-Control": "no-store",
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<h1>down</h1>", rec.Body.String())
+	assert.Equal(t, "text/html; charset=iso-8859-1", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "identity", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", resp.Header.Get("Last-Modified"))
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Empty(t, resp.Header.Get("Set-Cookie"))
+	assert.Empty(t, resp.Header.Get("X-Internal"))
+}
+
+func TestFallbackServeHTTPWithStatusClass(t *testing.T) {
+	for code, expectFallback := range map[int]bool{
+		http.StatusServiceUnavailable: true,
+		http.StatusNotImplemented:     false,
+	} {
+		code := code
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "5xx,!501",
+			FallbackURL:           "http://example.com",
+		}, "test")
+		assert.NoError(t, err)
+
+		fetcher := NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().CanFetch().Return(true)
+
+		if expectFallback {
+			fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+				Body: []byte("fallback"),
+			}, nil)
+		}
+
+		fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		if expectFallback {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "fallback", rec.Body.String())
+		} else {
+			assert.Equal(t, code, rec.Code)
+		}
+	}
+}
+
+func TestUpstreamTimeoutIsolation(t *testing.T) {
+	finished := make(chan error, 1)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+
+		// a misbehaving upstream keeps writing after being cancelled
+		w.Header().Set("X-Late", "1")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("late"))
+		w.(http.Flusher).Flush()
+
+		finished <- r.Context().Err()
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+		UpstreamTimeout:       "20ms",
+	}, "test")
+	assert.NoError(t, err)
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true)
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+		Body: []byte("fallback"),
+	}, nil)
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.ErrorIs(t, <-finished, context.Canceled)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "fallback", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("X-Late"))
+	assert.False(t, rec.Flushed)
+}
+
+func TestUpstreamTimeoutPanicIsolation(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(finished)
+
+		<-release
+		panic("late panic")
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+		UpstreamTimeout:       "20ms",
+	}, "test")
+	assert.NoError(t, err)
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true)
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+		Body: []byte("fallback"),
+	}, nil)
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+	close(release)
+	<-finished
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "fallback", rec.Body.String())
+}
+
+type ctxKey struct{}
+
+func TestUpstreamReceivesRequestContext(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Context().Value(ctxKey{}).(string)))
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "value"))
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, "value", rec.Body.String())
+}
+
+func TestFallbackServeHTTPUseOriginStatusCode(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for useOrigin, expected := range map[bool]int{
+		true:  http.StatusServiceUnavailable,
+		false: http.StatusAccepted,
+	} {
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "500",
+			FallbackURL:           "http://example.com",
+			FallbackStatusCode:    "202",
+			UseOriginStatusCode:   useOrigin,
+		}, "test")
+		assert.NoError(t, err)
+
+		fetcher := NewMockFetcher(gomock.NewController(t))
+		fetcher.EXPECT().CanFetch().Return(true)
+		fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+			Body:       []byte("maintenance"),
+			StatusCode: http.StatusServiceUnavailable,
+		}, nil)
+		fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Equal(t, expected, rec.Code)
+		assert.Equal(t, "maintenance", rec.Body.String())
+	}
+}
+
+func TestNewFallbackInvalidMaxFallbackBodySize(t *testing.T) {
+	for _, size := range []string{"abc", "0", "-1"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			MaxFallbackBodySize: size,
+		}, "test")
+
+		assert.Error(t, err, size)
+	}
+}
+
+func TestFallbackRejectsOriginErrors(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("origin stack trace"))
+	}))
+	defer origin.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	for acceptStatus, expected := range map[string]string{
+		"":          "origin stack trace",
+		"2xx":       "Service Unavailable",
+		"2xx,500":   "origin stack trace",
+		"200-299,!": "",
+	} {
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "502",
+			FallbackURL:           origin.URL,
+			FallbackAcceptStatus:  acceptStatus,
+		}, "test")
+
+		if expected == "" {
+			assert.Error(t, err)
+			continue
+		}
+
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Contains(t, rec.Body.String(), expected)
+	}
+}
+
+func TestNewFallbackInvalidStaleIfError(t *testing.T) {
+	for _, window := range []string{"abc", "-1s"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			StaleIfError: window,
+		}, "test")
+
+		assert.Error(t, err, window)
+	}
+}
+
+func TestNewFallbackInvalidStaleWhileRevalidate(t *testing.T) {
+	for _, window := range []string{"abc", "-1s"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			StaleWhileRevalidate: window,
+		}, "test")
+
+		assert.Error(t, err, window)
+	}
+}
+
+func TestFallbackUseOriginStatusCodeWithMaintenanceOrigin(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("<h1>maintenance</h1>"))
+	}))
+	defer origin.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		UseOriginStatusCode:   true,
+	}, "test")
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ { // the second response comes from the cache
+		rec := httptest.NewRecorder()
+		fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "<h1>maintenance</h1>", rec.Body.String())
+	}
 }
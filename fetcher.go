@@ -2,17 +2,135 @@ package traefik_fallback_plugin
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// defaultMaxBodySize caps fallback bodies unless configured otherwise.
+	defaultMaxBodySize = 10 << 20
+
+	// staleRetryInterval is how long a stale record is served after a failed
+	// refresh before the origin is tried again.
+	staleRetryInterval = 5 * time.Second
+)
+
 type HttpFetcher struct {
-	targetURL string
-	timeout   time.Duration
-	cacheTTL  time.Duration
-	client    *http.Client
-	cache     Cache
+	name         string
+	targetURL    string
+	timeout      time.Duration
+	cacheTTL     time.Duration
+	client       *http.Client
+	cache        Cache
+	proxy        bool
+	proxyHeaders []string
+	keyTemplate  *CacheKeyTemplate
+	maxBodySize  int64
+	accepted     *StatusMatcher
+	staleIfError time.Duration
+
+	staleWhileRevalidate time.Duration
+	revalidating         sync.Map
+
+	originCacheControl bool
+	minTTL             time.Duration
+	maxTTL             time.Duration
+}
+
+// OriginStatusError is returned when the fallback origin responds with a
+// status that is not accepted.
+type OriginStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *OriginStatusError) Error() string {
+	return fmt.Sprintf("fallback origin %s responded with status %d", e.URL, e.StatusCode)
+}
+
+// HttpFetcherOption customizes an HttpFetcher.
+type HttpFetcherOption func(h *HttpFetcher)
+
+// WithName sets the plugin name used in log messages.
+func WithName(name string) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.name = name
+	}
+}
+
+// WithProxy makes the fetcher forward the method, path and query of the
+// failing request, together with the listed headers, to the target URL
+// instead of always requesting the target URL itself. Only GET and HEAD
+// requests are forwarded, other methods fail instead of being replayed against
+// the fallback origin without their body.
+func WithProxy(headers []string) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.proxy = true
+		h.proxyHeaders = headers
+	}
+}
+
+// WithCacheKeyTemplate caches responses under keys rendered from the request
+// in addition to the requested URL.
+func WithCacheKeyTemplate(tmpl *CacheKeyTemplate) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.keyTemplate = tmpl
+	}
+}
+
+// WithMaxBodySize limits the size of fallback bodies, larger responses are
+// returned as errors.
+func WithMaxBodySize(size int64) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.maxBodySize = size
+	}
+}
+
+// WithAcceptedStatusCodes rejects fallback origin responses whose status does
+// not match. Rejected responses are never cached.
+func WithAcceptedStatusCodes(accepted *StatusMatcher) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.accepted = accepted
+	}
+}
+
+// WithStaleIfError keeps serving an expired record for up to window past its
+// expiry when refreshing it fails. After a failed refresh the stale record is
+// served without contacting the origin for a few seconds. Records whose
+// refresh is rejected by WithAcceptedStatusCodes are served regardless of the
+// window, a rejected response never replaces the last accepted one.
+func WithStaleIfError(window time.Duration) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.staleIfError = window
+	}
+}
+
+// WithStaleWhileRevalidate serves a record for up to window past its expiry
+// while refreshing it in the background.
+func WithStaleWhileRevalidate(window time.Duration) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.staleWhileRevalidate = window
+	}
+}
+
+// WithOriginCacheControl derives the TTL of fetched records from the
+// Cache-Control and Expires headers of the fallback origin, clamped between
+// minTTL and maxTTL. A zero maxTTL sets no upper bound. Responses without
+// freshness information keep the fetcher TTL and no-store responses are served
+// but never cached.
+func WithOriginCacheControl(minTTL time.Duration, maxTTL time.Duration) HttpFetcherOption {
+	return func(h *HttpFetcher) {
+		h.originCacheControl = true
+		h.minTTL = minTTL
+		h.maxTTL = maxTTL
+	}
 }
 
 func NewHttpFetcher(
@@ -21,14 +139,22 @@ func NewHttpFetcher(
 	targetURL string,
 	cacheTTL time.Duration,
 	timeout time.Duration,
+	opts ...HttpFetcherOption,
 ) *HttpFetcher {
-	return &HttpFetcher{
-		targetURL: targetURL,
-		cacheTTL:  cacheTTL,
-		timeout:   timeout,
-		client:    client,
-		cache:     cache,
+	h := &HttpFetcher{
+		targetURL:   targetURL,
+		cacheTTL:    cacheTTL,
+		timeout:     timeout,
+		client:      client,
+		cache:       cache,
+		maxBodySize: defaultMaxBodySize,
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
 }
 
 func (h *HttpFetcher) CanFetch() bool {
@@ -37,30 +163,293 @@ func (h *HttpFetcher) CanFetch() bool {
 
 func (h *HttpFetcher) Fetch(
 	ctx context.Context,
+	req *FetchRequest,
 ) (*CacheRecord, error) {
-	if rec, ok := h.cache.Load(h.targetURL); ok {
-		if !rec.IsExpired() {
+	method, targetURL, err := h.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := h.cacheKey(req, method, targetURL)
+
+	if rec, ok := h.cache.Load(key); ok {
+		if !rec.IsExpired() || rec.isBackingOff() {
 			return rec, nil
 		}
-	}
 
-	DefaultMutex.Lock(h.targetURL)
-	defer DefaultMutex.Unlock(h.targetURL)
+		if time.Now().Before(rec.ExpiresAt.Add(h.staleWhileRevalidate)) {
+			h.revalidate(ctx, req, method, targetURL, key)
 
-	if rec, ok := h.cache.Load(h.targetURL); ok {
-		if !rec.IsExpired() {
 			return rec, nil
 		}
 	}
 
+	return h.refresh(ctx, req, method, targetURL, key)
+}
+
+// Prefetch fetches and caches the target URL even if a fresh copy is cached,
+// keeping the cached copy when the fetch fails. Proxied and templated fetchers
+// cache per request, for them Prefetch only checks that the origin answers.
+func (h *HttpFetcher) Prefetch(ctx context.Context) error {
+	if !h.CanFetch() {
+		return nil
+	}
+
+	if h.proxy || h.keyTemplate != nil {
+		return h.probe(ctx)
+	}
+
+	key := h.cacheKey(nil, http.MethodGet, h.targetURL)
+
+	DefaultMutex.Lock(key)
+	defer DefaultMutex.Unlock(key)
+
+	previous, _ := h.cache.Load(key)
+
+	rec, err := h.fetch(ctx, nil, http.MethodGet, h.targetURL, previous)
+	if err != nil {
+		return err
+	}
+
+	h.store(key, rec)
+
+	return nil
+}
+
+// probe requests the target URL without caching the response, any status
+// counts as reachable.
+func (h *HttpFetcher) probe(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, h.timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.targetURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	return nil
+}
+
+// refresh fetches and caches key unless another caller refreshed it while
+// waiting for the lock.
+func (h *HttpFetcher) refresh(
+	ctx context.Context,
+	req *FetchRequest,
+	method string,
+	targetURL string,
+	key string,
+) (*CacheRecord, error) {
+	DefaultMutex.Lock(key)
+	defer DefaultMutex.Unlock(key)
+
+	previous, ok := h.cache.Load(key)
+	if ok && (!previous.IsExpired() || previous.isBackingOff()) {
+		return previous, nil
+	}
+
+	rec, err := h.fetch(ctx, req, method, targetURL, previous)
+	if err != nil {
+		if previous == nil {
+			return nil, err
+		}
+
+		until, canServe := h.staleUntil(previous, err)
+		if !canServe {
+			return nil, err
+		}
+
+		log.Printf("[%s] fallback refresh failed, serving stale content: %v", h.name, err)
+
+		return h.markStale(key, previous, until), nil
+	}
+
+	h.store(key, rec)
+
+	return rec, nil
+}
+
+// store caches rec unless the origin forbids it.
+func (h *HttpFetcher) store(key string, rec *CacheRecord) {
+	if h.originCacheControl && isNoStore(rec.Header) {
+		return
+	}
+
+	h.cache.Store(key, rec)
+}
+
+// ttl returns how long a response with header stays fresh.
+func (h *HttpFetcher) ttl(header http.Header) time.Duration {
+	if !h.originCacheControl {
+		return h.cacheTTL
+	}
+
+	ttl, ok := originTTL(header, time.Now())
+	if !ok {
+		ttl = h.cacheTTL
+	}
+
+	if ttl < h.minTTL {
+		ttl = h.minTTL
+	}
+
+	if h.maxTTL > 0 && ttl > h.maxTTL {
+		ttl = h.maxTTL
+	}
+
+	return ttl
+}
+
+// revalidate refreshes key in the background, at most once at a time. The
+// refresh is bound to ctx, the plugin context for fallback requests.
+func (h *HttpFetcher) revalidate(
+	ctx context.Context,
+	req *FetchRequest,
+	method string,
+	targetURL string,
+	key string,
+) {
+	if _, running := h.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	if req != nil && req.Request != nil { // the original request ends before the refresh does
+		req = &FetchRequest{
+			Request:     req.Request.Clone(ctx),
+			Outcome:     req.Outcome,
+			ContentType: req.ContentType,
+		}
+	}
+
+	go func() {
+		defer h.revalidating.Delete(key)
+
+		if _, err := h.refresh(ctx, req, method, targetURL, key); err != nil {
+			log.Printf("[%s] background fallback refresh failed: %v", h.name, err)
+		}
+	}()
+}
+
+// staleUntil reports whether previous may be served after a failed refresh
+// and until when, a zero time meaning without limit. A rejected origin status
+// never replaces the last good response.
+func (h *HttpFetcher) staleUntil(previous *CacheRecord, err error) (time.Time, bool) {
+	var statusErr *OriginStatusError
+	if errors.As(err, &statusErr) {
+		return time.Time{}, true
+	}
+
+	until := previous.ExpiresAt.Add(h.staleIfError)
+
+	return until, time.Now().Before(until)
+}
+
+// markStale caches a stale copy of previous that is served without retrying
+// the origin until the retry interval, or the stale window, has passed.
+func (h *HttpFetcher) markStale(key string, previous *CacheRecord, until time.Time) *CacheRecord {
+	stale := *previous
+	stale.Stale = true
+	stale.RetryAt = time.Now().Add(staleRetryInterval)
+
+	if !until.IsZero() && until.Before(stale.RetryAt) {
+		stale.RetryAt = until
+	}
+
+	h.cache.Store(key, &stale)
+
+	return &stale
+}
+
+func (h *HttpFetcher) cacheKey(req *FetchRequest, method string, targetURL string) string {
+	key := targetURL
+	if h.keyTemplate != nil { // refines the resolved URL, proxied paths stay apart
+		key = targetURL + "#" + h.keyTemplate.Render(req)
+	}
+
+	if h.proxy && len(h.proxyHeaders) > 0 && req != nil && req.Request != nil {
+		// responses may differ by every forwarded header
+		forwarded := url.Values{}
+		for _, name := range h.proxyHeaders {
+			forwarded[name] = req.Request.Header.Values(name)
+		}
+
+		key += " " + forwarded.Encode()
+	}
+
+	if method == http.MethodHead {
+		key = method + " " + key
+	}
+
+	return key
+}
+
+// resolve returns the method and URL to request for req.
+func (h *HttpFetcher) resolve(req *FetchRequest) (string, string, error) {
+	if !h.proxy || req == nil || req.Request == nil {
+		return http.MethodGet, h.targetURL, nil
+	}
+
+	base, err := url.Parse(h.targetURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	original := req.Request.URL
+
+	target := *base
+	target.Path = strings.TrimSuffix(base.Path, "/") + original.Path
+	target.RawPath = ""
+	target.RawQuery = original.RawQuery
+
+	if original.RawPath != "" {
+		target.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + original.RawPath
+	}
+
+	method := req.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if method != http.MethodGet && method != http.MethodHead {
+		return "", "", fmt.Errorf("method %s is not proxied to the fallback origin", method)
+	}
+
+	return method, target.String(), nil
+}
+
+func (h *HttpFetcher) fetch(
+	ctx context.Context,
+	fetchReq *FetchRequest,
+	method string,
+	targetURL string,
+	previous *CacheRecord,
+) (*CacheRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if h.proxy && fetchReq != nil && fetchReq.Request != nil {
+		for _, name := range h.proxyHeaders {
+			for _, value := range fetchReq.Request.Header.Values(name) {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+
+	conditional := previous != nil && setConditionalHeaders(req.Header, previous)
+
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -72,22 +461,97 @@ func (h *HttpFetcher) Fetch(
 		}
 	}()
 
-	var bodyBytes []byte
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return h.revalidated(previous, resp), nil
+	}
 
-	if resp.Body != nil && resp.ContentLength > 0 {
-		bodyBytes, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+	if h.accepted != nil && !h.accepted.Match(resp.StatusCode) {
+		return nil, &OriginStatusError{URL: targetURL, StatusCode: resp.StatusCode}
+	}
+
+	bodyBytes, err := h.readBody(resp)
+	if err != nil {
+		return nil, err
 	}
 
-	rec := &CacheRecord{
+	return &CacheRecord{
 		Body:        bodyBytes,
 		ContentType: resp.Header.Get("Content-Type"),
-		ExpiresAt:   time.Now().Add(h.cacheTTL),
+		StatusCode:  resp.StatusCode,
+		Header:      filterRecordHeaders(resp.Header),
+		ExpiresAt:   time.Now().Add(h.ttl(resp.Header)),
+	}, nil
+}
+
+// setConditionalHeaders asks the origin to answer 304 Not Modified while the
+// validators of previous still match. It reports whether previous had any.
+func setConditionalHeaders(header http.Header, previous *CacheRecord) bool {
+	etag := previous.Header.Get("Etag")
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+
+	lastModified := previous.Header.Get("Last-Modified")
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
 	}
 
-	h.cache.Store(h.targetURL, rec)
+	return etag != "" || lastModified != ""
+}
 
-	return rec, nil
+// revalidated returns a fresh copy of previous updated with the headers of a
+// 304 Not Modified response.
+func (h *HttpFetcher) revalidated(previous *CacheRecord, resp *http.Response) *CacheRecord {
+	rec := *previous
+	rec.Stale = false
+	rec.Header = previous.Header.Clone()
+
+	if rec.Header == nil {
+		rec.Header = http.Header{}
+	}
+
+	for name, values := range filterRecordHeaders(resp.Header) {
+		rec.Header[name] = values
+	}
+
+	// the freshness of the updated record is measured against the Date and
+	// Age of the 304, which are not kept in the record headers
+	freshness := rec.Header.Clone()
+
+	for _, name := range []string{"Date", "Age"} {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			freshness[name] = values
+		}
+	}
+
+	rec.ExpiresAt = time.Now().Add(h.ttl(freshness))
+
+	return &rec
+}
+
+// readBody reads the whole body, including chunked responses of unknown
+// length, up to maxBodySize.
+func (h *HttpFetcher) readBody(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+
+	if resp.ContentLength > h.maxBodySize {
+		return nil, fmt.Errorf("fallback body of %d bytes exceeds %d bytes", resp.ContentLength, h.maxBodySize)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, h.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > h.maxBodySize {
+		return nil, fmt.Errorf("fallback body exceeds %d bytes", h.maxBodySize)
+	}
+
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	return body, nil
 }
@@ -0,0 +1,114 @@
+package traefik_fallback_plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const defaultDirIndex = "index.html"
+
+// DirFetcher maps the request path onto files below a directory. Directories
+// resolve to their index file and, in SPA mode, missing files resolve to the
+// root index file.
+type DirFetcher struct {
+	dir   string
+	index string
+	spa   bool
+	cache Cache
+}
+
+func NewDirFetcher(
+	cache Cache,
+	dir string,
+	index string,
+	spa bool,
+) *DirFetcher {
+	if index == "" {
+		index = defaultDirIndex
+	}
+
+	return &DirFetcher{
+		dir:   filepath.Clean(dir),
+		index: index,
+		spa:   spa,
+		cache: cache,
+	}
+}
+
+func (d *DirFetcher) CanFetch() bool {
+	return d.dir != "" && d.dir != "."
+}
+
+func (d *DirFetcher) Fetch(
+	_ context.Context,
+	req *FetchRequest,
+) (*CacheRecord, error) {
+	requestPath := "/"
+	if req != nil && req.Request != nil {
+		requestPath = req.Request.URL.Path
+	}
+
+	var rec *CacheRecord
+
+	filePath, err := d.resolve(requestPath)
+	if err == nil {
+		rec, err = fetchFile(d.cache, filePath, "")
+	}
+
+	if err == nil || !errors.Is(err, os.ErrNotExist) || !d.spa {
+		return rec, err
+	}
+
+	indexPath, err := d.resolve("/")
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchFile(d.cache, indexPath, "")
+}
+
+// resolve maps a request path to a file inside the directory, refusing
+// anything that would escape it, including through symlinks.
+func (d *DirFetcher) resolve(requestPath string) (string, error) {
+	if strings.Contains(requestPath, "\x00") || strings.Contains(requestPath, "\\") {
+		return "", fmt.Errorf("invalid fallback path: %q", requestPath)
+	}
+
+	cleaned := path.Clean("/" + requestPath)
+	filePath := filepath.Join(d.dir, filepath.FromSlash(cleaned))
+
+	if !isWithin(d.dir, filePath) {
+		return "", fmt.Errorf("invalid fallback path: %q", requestPath)
+	}
+
+	if info, statErr := os.Stat(filePath); statErr == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, d.index)
+	}
+
+	root, err := filepath.EvalSymlinks(d.dir)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if !isWithin(root, resolved) {
+		return "", fmt.Errorf("invalid fallback path: %q", requestPath)
+	}
+
+	return resolved, nil
+}
+
+func isWithin(dir string, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,142 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func newFallbackDir(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "site")
+
+	files := map[string]string{
+		"site/index.html":        "<h1>app</h1>",
+		"site/assets/app.js":     "console.log('offline')",
+		"site/docs/index.html":   "<h1>docs</h1>",
+		"site/docs/guide.html":   "<h1>guide</h1>",
+		"secret.txt":             "secret",
+		"site-private/token.txt": "token",
+	}
+
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(full), 0o700))
+		assert.NoError(t, os.WriteFile(full, []byte(content), 0o600))
+	}
+
+	return dir
+}
+
+func TestDirFetcher(t *testing.T) {
+	dir := newFallbackDir(t)
+
+	cases := []struct {
+		name        string
+		spa         bool
+		path        string
+		body        string
+		contentType string
+		err         bool
+	}{
+		{name: "root", path: "/", body: "<h1>app</h1>", contentType: "text/html; charset=utf-8"},
+		{name: "asset", path: "/assets/app.js", body: "console.log('offline')", contentType: "text/javascript; charset=utf-8"},
+		{name: "sub directory index", path: "/docs/", body: "<h1>docs</h1>"},
+		{name: "sub directory without slash", path: "/docs", body: "<h1>docs</h1>"},
+		{name: "file in sub directory", path: "/docs/guide.html", body: "<h1>guide</h1>"},
+		{name: "missing file", path: "/orders/42", err: true},
+		{name: "spa catch all", spa: true, path: "/orders/42", body: "<h1>app</h1>"},
+		{name: "traversal", path: "/../secret.txt", err: true},
+		{name: "encoded traversal", path: "/assets/../../secret.txt", err: true},
+		{name: "sibling directory prefix", path: "/../site-private/token.txt", err: true},
+		{name: "backslash", path: "/..\\secret.txt", err: true},
+		{name: "spa traversal", spa: true, path: "/../secret.txt", body: "<h1>app</h1>"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fc := traefik_fallback_plugin.NewDirFetcher(traefik_fallback_plugin.NewDefaultCache(), dir, "", c.spa)
+			assert.True(t, fc.CanFetch())
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = c.path
+
+			rec, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, c.body, string(rec.Body))
+
+			if c.contentType != "" {
+				assert.EqualValues(t, c.contentType, rec.ContentType)
+			}
+		})
+	}
+}
+
+func TestFallbackFromDir(t *testing.T) {
+	dir := newFallbackDir(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackDir:           dir,
+		FallbackDirSPA:        true,
+	}, "test")
+	assert.NoError(t, err)
+
+	for reqPath, body := range map[string]string{
+		"/assets/app.js": "console.log('offline')",
+		"/settings":      "<h1>app</h1>",
+	} {
+		req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, body, rec.Body.String())
+	}
+}
+
+func TestDirFetcherSymlinkEscape(t *testing.T) {
+	dir := newFallbackDir(t)
+	root := filepath.Dir(dir)
+
+	assert.NoError(t, os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "leak.txt")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "site-private"), filepath.Join(dir, "private")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "docs", "guide.html"), filepath.Join(dir, "guide.html")))
+
+	fc := traefik_fallback_plugin.NewDirFetcher(traefik_fallback_plugin.NewDefaultCache(), dir, "", false)
+
+	for requestPath, expected := range map[string]string{
+		"/leak.txt":          "",
+		"/private/token.txt": "",
+		"/guide.html":        "<h1>guide</h1>", // links inside the directory keep working
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = requestPath
+
+		rec, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+		if expected == "" {
+			assert.Error(t, err, requestPath)
+			continue
+		}
+
+		assert.NoError(t, err, requestPath)
+		assert.EqualValues(t, expected, string(rec.Body))
+	}
+}
@@ -0,0 +1,123 @@
+package traefik_fallback_plugin
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// FileFetcher serves fallback content from a local file and reloads it once
+// the file modification time or size changes.
+type FileFetcher struct {
+	path        string
+	contentType string
+	cache       Cache
+}
+
+func NewFileFetcher(
+	cache Cache,
+	path string,
+	contentType string,
+) *FileFetcher {
+	return &FileFetcher{
+		path:        path,
+		contentType: contentType,
+		cache:       cache,
+	}
+}
+
+func (h *FileFetcher) CanFetch() bool {
+	return h.path != ""
+}
+
+func (h *FileFetcher) Fetch(
+	_ context.Context,
+	_ *FetchRequest,
+) (*CacheRecord, error) {
+	return fetchFile(h.cache, h.path, h.contentType)
+}
+
+// Prefetch loads the file into the cache.
+func (h *FileFetcher) Prefetch(_ context.Context) error {
+	_, err := fetchFile(h.cache, h.path, h.contentType)
+
+	return err
+}
+
+// fetchFile loads path through cache, re-reading it once its modification time
+// or size changes.
+func fetchFile(cache Cache, path string, contentType string) (*CacheRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := "file://" + path
+
+	if rec, ok := cache.Load(key); ok && isFileRecordCurrent(rec, info) {
+		return rec, nil
+	}
+
+	DefaultMutex.Lock(key)
+	defer DefaultMutex.Unlock(key)
+
+	if rec, ok := cache.Load(key); ok && isFileRecordCurrent(rec, info) {
+		return rec, nil
+	}
+
+	rec, err := readFileRecord(path, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Store(key, rec)
+
+	return rec, nil
+}
+
+func isFileRecordCurrent(rec *CacheRecord, info os.FileInfo) bool {
+	return rec.ModTime.Equal(info.ModTime()) && int64(len(rec.Body)) == info.Size()
+}
+
+func readFileRecord(path string, contentType string) (*CacheRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// stat the opened file so the recorded version matches what was read
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, info.Size())
+	if _, err = io.ReadFull(file, body); err != nil {
+		return nil, err
+	}
+
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	return &CacheRecord{
+		Body:        body,
+		ContentType: contentType,
+		Header: http.Header{
+			"Content-Type":  []string{contentType},
+			"Last-Modified": []string{info.ModTime().UTC().Format(http.TimeFormat)},
+		},
+		ModTime: info.ModTime(),
+	}, nil
+}
@@ -0,0 +1,95 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestFileFetcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.html")
+	assert.NoError(t, os.WriteFile(path, []byte("<h1>v1</h1>"), 0o600))
+
+	fc := traefik_fallback_plugin.NewFileFetcher(traefik_fallback_plugin.NewDefaultCache(), path, "")
+
+	assert.True(t, fc.CanFetch())
+
+	first, err := fc.Fetch(context.TODO(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "<h1>v1</h1>", string(first.Body))
+	assert.EqualValues(t, "text/html; charset=utf-8", first.ContentType)
+
+	t.Run("unchanged file is served from cache", func(t *testing.T) {
+		rec, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, fetchErr)
+		assert.Same(t, first, rec)
+	})
+
+	t.Run("size change reloads", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte("<h1>version 2</h1>"), 0o600))
+
+		rec, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, fetchErr)
+		assert.EqualValues(t, "<h1>version 2</h1>", string(rec.Body))
+	})
+
+	t.Run("mtime change reloads", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte("<h1>version 3</h1>"), 0o600))
+		assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+
+		rec, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, fetchErr)
+		assert.EqualValues(t, "<h1>version 3</h1>", string(rec.Body))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		assert.NoError(t, os.Remove(path))
+
+		rec, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.Error(t, fetchErr)
+		assert.Nil(t, rec)
+	})
+}
+
+func TestFileFetcherContentType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"status":"maintenance"}`), 0o600))
+
+	fc := traefik_fallback_plugin.NewFileFetcher(traefik_fallback_plugin.NewDefaultCache(), path, "application/json")
+
+	rec, err := fc.Fetch(context.TODO(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "application/json", rec.ContentType)
+}
+
+func TestFallbackFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("be right back"), 0o600))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "503",
+		FallbackFile:          path,
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "be right back", rec.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,35 @@
+package traefik_fallback_plugin
+
+import (
+	"context"
+	"net/http"
+)
+
+// StaticFetcher serves a fallback body supplied in the configuration.
+type StaticFetcher struct {
+	record *CacheRecord
+}
+
+func NewStaticFetcher(body []byte, contentType string) *StaticFetcher {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	return &StaticFetcher{
+		record: &CacheRecord{
+			Body:        body,
+			ContentType: contentType,
+		},
+	}
+}
+
+func (s *StaticFetcher) CanFetch() bool {
+	return true
+}
+
+func (s *StaticFetcher) Fetch(
+	_ context.Context,
+	_ *FetchRequest,
+) (*CacheRecord, error) {
+	return s.record, nil
+}
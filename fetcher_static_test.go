@@ -0,0 +1,91 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestStaticFetcher(t *testing.T) {
+	t.Run("explicit content type", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewStaticFetcher([]byte("maintenance"), "text/plain")
+
+		assert.True(t, fc.CanFetch())
+
+		record, err := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "maintenance", string(record.Body))
+		assert.EqualValues(t, "text/plain", record.ContentType)
+	})
+
+	t.Run("detected content type", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewStaticFetcher([]byte("<html><body>down</body></html>"), "")
+
+		record, err := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "text/html; charset=utf-8", record.ContentType)
+	})
+}
+
+func TestInlineFallbackBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	cases := []struct {
+		name   string
+		config *traefik_fallback_plugin.Config
+		body   string
+	}{
+		{
+			name: "plain",
+			config: &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "503",
+				FallbackBody:          "<h1>maintenance</h1>",
+				FallbackContentType:   "text/html",
+			},
+			body: "<h1>maintenance</h1>",
+		},
+		{
+			name: "base64",
+			config: &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "503",
+				FallbackBodyBase64:    base64.StdEncoding.EncodeToString([]byte("<h1>maintenance</h1>")),
+				FallbackContentType:   "text/html",
+			},
+			body: "<h1>maintenance</h1>",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fallback, err := traefik_fallback_plugin.New(context.Background(), handler, c.config, "test")
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, c.body, rec.Body.String())
+			assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestInlineFallbackBodyInvalidConfig(t *testing.T) {
+	for _, config := range []*traefik_fallback_plugin.Config{
+		{FallbackBodyBase64: "not base64!"},
+		{FallbackBody: "a", FallbackBodyBase64: "YQ=="},
+	} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), config, "test")
+		assert.Error(t, err)
+	}
+}
@@ -3,8 +3,15 @@ package traefik_fallback_plugin_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -57,7 +64,7 @@ func TestFetcher(t *testing.T) {
 
 		assert.True(t, fc.CanFetch())
 
-		record, err := fc.Fetch(context.TODO())
+		record, err := fc.Fetch(context.TODO(), nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, record)
 		assert.EqualValues(t, "test", string(record.Body))
@@ -82,7 +89,7 @@ func TestFetcherCache(t *testing.T) {
 		cache.EXPECT().Load("http://example.com/index.html").
 			Return(rec, true)
 
-		resp, err := fc.Fetch(context.TODO())
+		resp, err := fc.Fetch(context.TODO(), nil)
 		assert.NoError(t, err)
 		assert.Equal(t, rec, resp)
 	})
@@ -111,8 +118,850 @@ func TestFetcherCache(t *testing.T) {
 		cache.EXPECT().Load("http://example.com/index.html").
 			Return(rec2, true)
 
-		resp, err := fc.Fetch(context.TODO())
+		resp, err := fc.Fetch(context.TODO(), nil)
 		assert.NoError(t, err)
 		assert.Equal(t, rec2, resp)
 	})
 }
+
+func TestFetcherProxy(t *testing.T) {
+	t.Run("forwards request and caches per path", func(t *testing.T) {
+		transport := NewMockTransport(gomock.NewController(t))
+
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			&http.Client{Transport: transport},
+			traefik_fallback_plugin.NewDefaultCache(),
+			"http://mirror.internal/static/",
+			30*time.Second,
+			60*time.Second,
+			traefik_fallback_plugin.WithProxy([]string{"Accept-Language", "X-Tenant"}),
+		)
+
+		transport.EXPECT().RoundTrip(gomock.Any()).
+			DoAndReturn(func(request *http.Request) (*http.Response, error) {
+				assert.EqualValues(t, http.MethodGet, request.Method)
+				assert.EqualValues(t, "de", request.Header.Get("Accept-Language"))
+				assert.EqualValues(t, "acme", request.Header.Get("X-Tenant"))
+				assert.Empty(t, request.Header.Get("Authorization"))
+
+				body := "page " + request.URL.String()
+
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Body:          io.NopCloser(bytes.NewBufferString(body)),
+					ContentLength: int64(len(body)),
+				}, nil
+			}).Times(2)
+
+		fetch := func(target string) string {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("Accept-Language", "de")
+			req.Header.Set("X-Tenant", "acme")
+			req.Header.Set("Authorization", "Bearer secret")
+
+			record, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+			assert.NoError(t, err)
+
+			return string(record.Body)
+		}
+
+		assert.EqualValues(t, "page http://mirror.internal/static/products/1?color=red", fetch("http://shop.example.com/products/1?color=red"))
+		assert.EqualValues(t, "page http://mirror.internal/static/products/2", fetch("http://shop.example.com/products/2"))
+		assert.EqualValues(t, "page http://mirror.internal/static/products/1?color=red", fetch("http://shop.example.com/products/1?color=red"))
+	})
+
+	t.Run("caches per forwarded header value", func(t *testing.T) {
+		transport := NewMockTransport(gomock.NewController(t))
+
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			&http.Client{Transport: transport},
+			traefik_fallback_plugin.NewDefaultCache(),
+			"http://mirror.internal",
+			30*time.Second,
+			60*time.Second,
+			traefik_fallback_plugin.WithProxy([]string{"X-Tenant"}),
+		)
+
+		transport.EXPECT().RoundTrip(gomock.Any()).
+			DoAndReturn(func(request *http.Request) (*http.Response, error) {
+				body := "tenant " + request.Header.Get("X-Tenant")
+
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Body:          io.NopCloser(bytes.NewBufferString(body)),
+					ContentLength: int64(len(body)),
+				}, nil
+			}).Times(3)
+
+		fetch := func(tenants ...string) string {
+			req := httptest.NewRequest(http.MethodGet, "/x", nil)
+			for _, tenant := range tenants {
+				req.Header.Add("X-Tenant", tenant)
+			}
+
+			record, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+			assert.NoError(t, err)
+
+			return string(record.Body)
+		}
+
+		assert.EqualValues(t, "tenant acme", fetch("acme"))
+		assert.EqualValues(t, "tenant globex", fetch("globex"))
+		assert.EqualValues(t, "tenant ", fetch())
+		assert.EqualValues(t, "tenant acme", fetch("acme"))
+		assert.EqualValues(t, "tenant globex", fetch("globex"))
+	})
+
+	t.Run("refuses unsafe methods", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			&http.Client{Transport: NewMockTransport(gomock.NewController(t))},
+			NewMockCache(gomock.NewController(t)),
+			"http://mirror.internal",
+			30*time.Second,
+			60*time.Second,
+			traefik_fallback_plugin.WithProxy(nil),
+		)
+
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			req := httptest.NewRequest(method, "/orders/1", bytes.NewBufferString(`{"id":1}`))
+
+			_, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{Request: req})
+			assert.Error(t, err, method)
+		}
+	})
+}
+
+func TestFallbackProxyUnsafeMethod(t *testing.T) {
+	var hits int32
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mirror.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           mirror.URL,
+		FallbackProxy:         true,
+	}, "test")
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/orders/1", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEqual(t, "ok", rec.Body.String())
+	assert.EqualValues(t, 0, atomic.LoadInt32(&hits))
+}
+
+func TestFallbackProxyTimeout(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond) // within its own budget, not the one left by the upstream
+
+		_, _ = w.Write([]byte("mirror " + r.URL.RequestURI()))
+	}))
+	defer mirror.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           mirror.URL,
+		FallbackProxy:         true,
+		UpstreamTimeout:       "50ms",
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/catalog?page=2", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "mirror /catalog?page=2", rec.Body.String())
+}
+
+func TestFetcherRecordsOriginMetadata(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		traefik_fallback_plugin.NewDefaultCache(),
+		"http://example.com/index.html",
+		30*time.Second,
+		60*time.Second)
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header: http.Header{
+				"Content-Type":     []string{"text/html; charset=utf-8"},
+				"Content-Language": []string{"de"},
+				"Etag":             []string{`"abc"`},
+				"Last-Modified":    []string{"Wed, 21 Oct 2015 07:28:00 GMT"},
+				"Set-Cookie":       []string{"a=b"},
+				"Server":           []string{"nginx"},
+			},
+			Body:          io.NopCloser(bytes.NewBufferString("down")),
+			ContentLength: 4,
+		}, nil)
+
+	record, err := fc.Fetch(context.TODO(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, record.StatusCode)
+	assert.Equal(t, http.Header{
+		"Content-Type":     []string{"text/html; charset=utf-8"},
+		"Content-Language": []string{"de"},
+		"Etag":             []string{`"abc"`},
+		"Last-Modified":    []string{"Wed, 21 Oct 2015 07:28:00 GMT"},
+	}, record.Header)
+}
+
+func TestFetcherChunkedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		for _, chunk := range []string{"<h1>", "maintenance", "</h1>"} {
+			_, _ = w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("reads unknown length body", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			srv.Client(),
+			traefik_fallback_plugin.NewDefaultCache(),
+			srv.URL,
+			30*time.Second,
+			5*time.Second)
+
+		record, err := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "<h1>maintenance</h1>", string(record.Body))
+	})
+
+	t.Run("exceeds max size", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			srv.Client(),
+			traefik_fallback_plugin.NewDefaultCache(),
+			srv.URL,
+			30*time.Second,
+			5*time.Second,
+			traefik_fallback_plugin.WithMaxBodySize(10))
+
+		record, err := fc.Fetch(context.TODO(), nil)
+		assert.ErrorContains(t, err, "fallback body exceeds 10 bytes")
+		assert.Nil(t, record)
+	})
+
+	t.Run("exactly max size", func(t *testing.T) {
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			srv.Client(),
+			traefik_fallback_plugin.NewDefaultCache(),
+			srv.URL,
+			30*time.Second,
+			5*time.Second,
+			traefik_fallback_plugin.WithMaxBodySize(20))
+
+		record, err := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "<h1>maintenance</h1>", string(record.Body))
+	})
+}
+
+func TestFetcherDeclaredLengthExceedsMaxSize(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		traefik_fallback_plugin.NewDefaultCache(),
+		"http://example.com/index.html",
+		30*time.Second,
+		60*time.Second,
+		traefik_fallback_plugin.WithMaxBodySize(3))
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString("test")),
+			ContentLength: 4,
+		}, nil)
+
+	_, err := fc.Fetch(context.TODO(), nil)
+	assert.ErrorContains(t, err, "fallback body of 4 bytes exceeds 3 bytes")
+}
+
+func TestFetcherAcceptedStatusCodes(t *testing.T) {
+	accepted, err := traefik_fallback_plugin.ParseStatusMatcher("2xx")
+	assert.NoError(t, err)
+
+	errorResponse := func(request *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusNotFound,
+			Body:          io.NopCloser(bytes.NewBufferString("not found")),
+			ContentLength: 9,
+		}, nil
+	}
+
+	t.Run("rejected without cached copy", func(t *testing.T) {
+		transport := NewMockTransport(gomock.NewController(t))
+		cache := NewMockCache(gomock.NewController(t))
+
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			&http.Client{Transport: transport},
+			cache,
+			"http://example.com/index.html",
+			30*time.Second,
+			60*time.Second,
+			traefik_fallback_plugin.WithAcceptedStatusCodes(accepted))
+
+		cache.EXPECT().Load("http://example.com/index.html").Return(nil, false).Times(2)
+		transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(errorResponse)
+
+		record, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.Nil(t, record)
+
+		var statusErr *traefik_fallback_plugin.OriginStatusError
+		assert.ErrorAs(t, fetchErr, &statusErr)
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	})
+
+	t.Run("rejected keeps cached copy", func(t *testing.T) {
+		transport := NewMockTransport(gomock.NewController(t))
+		cache := NewMockCache(gomock.NewController(t))
+
+		previous := &traefik_fallback_plugin.CacheRecord{
+			Body:      []byte("good"),
+			ExpiresAt: time.Now().Add(-time.Second),
+		}
+
+		fc := traefik_fallback_plugin.NewHttpFetcher(
+			&http.Client{Transport: transport},
+			cache,
+			"http://example.com/index.html",
+			30*time.Second,
+			60*time.Second,
+			traefik_fallback_plugin.WithAcceptedStatusCodes(accepted))
+
+		cache.EXPECT().Load("http://example.com/index.html").Return(previous, true).Times(2)
+		cache.EXPECT().Store("http://example.com/index.html", gomock.Any()).
+			DoAndReturn(func(s string, record *traefik_fallback_plugin.CacheRecord) {
+				// the good body is kept, only marked as stale
+				assert.EqualValues(t, "good", string(record.Body))
+				assert.True(t, record.Stale)
+			})
+		transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(errorResponse)
+
+		record, fetchErr := fc.Fetch(context.TODO(), nil)
+		assert.NoError(t, fetchErr)
+		assert.EqualValues(t, "good", string(record.Body))
+		assert.True(t, record.Stale)
+		assert.False(t, previous.Stale)
+	})
+}
+
+func TestFetcherStaleIfError(t *testing.T) {
+	failing := func(request *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	cases := []struct {
+		name      string
+		expiredAt time.Duration
+		window    time.Duration
+		stale     bool
+	}{
+		{name: "within window", expiredAt: -time.Minute, window: 5 * time.Minute, stale: true},
+		{name: "past window", expiredAt: -10 * time.Minute, window: 5 * time.Minute},
+		{name: "no window", expiredAt: -time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			transport := NewMockTransport(gomock.NewController(t))
+			cache := traefik_fallback_plugin.NewDefaultCache()
+
+			cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+				Body:      []byte("good"),
+				ExpiresAt: time.Now().Add(c.expiredAt),
+			})
+
+			fc := traefik_fallback_plugin.NewHttpFetcher(
+				&http.Client{Transport: transport},
+				cache,
+				"http://example.com/index.html",
+				30*time.Second,
+				60*time.Second,
+				traefik_fallback_plugin.WithStaleIfError(c.window))
+
+			roundTrips := 2
+			if c.stale {
+				roundTrips = 1 // the stale copy is served without retrying the origin
+			}
+
+			transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(failing).Times(roundTrips)
+
+			for i := 0; i < 2; i++ {
+				record, err := fc.Fetch(context.TODO(), nil)
+
+				if !c.stale {
+					assert.ErrorContains(t, err, "connection refused")
+					assert.Nil(t, record)
+
+					continue
+				}
+
+				assert.NoError(t, err)
+				assert.EqualValues(t, "good", string(record.Body))
+				assert.True(t, record.Stale)
+			}
+		})
+	}
+}
+
+func TestFetcherStaleIfErrorBacksOff(t *testing.T) {
+	var hits int32
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer origin.Close()
+
+	accepted, err := traefik_fallback_plugin.ParseStatusMatcher("2xx")
+	assert.NoError(t, err)
+
+	cache := traefik_fallback_plugin.NewDefaultCache()
+	cache.Store(origin.URL, &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("good"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		origin.Client(),
+		cache,
+		origin.URL,
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithAcceptedStatusCodes(accepted),
+		traefik_fallback_plugin.WithStaleIfError(time.Minute))
+
+	started := time.Now()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			record, fetchErr := fc.Fetch(context.Background(), nil)
+			assert.NoError(t, fetchErr)
+			assert.EqualValues(t, "good", string(record.Body))
+			assert.True(t, record.Stale)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&hits))
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+
+	record, ok := cache.Load(origin.URL)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), record.RetryAt, time.Second)
+}
+
+func TestFetcherStaleRetryLimitedByWindow(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	expiredAt := time.Now().Add(-time.Minute)
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("good"),
+		ExpiresAt: expiredAt,
+	})
+
+	transport.EXPECT().RoundTrip(gomock.Any()).Return(nil, errors.New("connection refused"))
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithStaleIfError(time.Minute+time.Second))
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.True(t, record.Stale)
+	assert.Equal(t, expiredAt.Add(time.Minute+time.Second), record.RetryAt)
+}
+
+func TestFetcherStaleWhileRevalidate(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	release := make(chan struct{})
+	refreshed := make(chan struct{})
+
+	var running, maxRunning int32
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				prev := atomic.LoadInt32(&maxRunning)
+				if current <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, current) {
+					break
+				}
+			}
+
+			<-release
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Body:          io.NopCloser(bytes.NewBufferString("new")),
+				ContentLength: 3,
+			}, nil
+		}).Times(1)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithStaleWhileRevalidate(time.Minute))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			record, err := fc.Fetch(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "old", string(record.Body)) // served without waiting for the origin
+		}()
+	}
+
+	wg.Wait()
+	close(release)
+
+	go func() {
+		defer close(refreshed)
+
+		for {
+			if rec, ok := cache.Load("http://example.com/index.html"); ok && !rec.IsExpired() {
+				return
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background refresh did not complete")
+	}
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "new", string(record.Body))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&maxRunning))
+}
+
+func TestFetcherStaleWhileRevalidateLogsFailure(t *testing.T) {
+	var logs lockedBuffer
+
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	transport.EXPECT().RoundTrip(gomock.Any()).Return(nil, errors.New("connection refused"))
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithName("test"),
+		traefik_fallback_plugin.WithStaleWhileRevalidate(time.Minute))
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "old", string(record.Body))
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "[test] background fallback refresh failed: ")
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Contains(t, logs.String(), "connection refused")
+}
+
+// lockedBuffer collects log output written from background goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestFetcherStaleWhileRevalidateWindowExceeded(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString("new")),
+			ContentLength: 3,
+		}, nil)
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithStaleWhileRevalidate(time.Minute))
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "new", string(record.Body))
+}
+
+func TestFetcherPrefetch(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second)
+
+	transport.EXPECT().RoundTrip(gomock.Any()).Return(nil, errors.New("connection refused"))
+
+	assert.Error(t, fc.Prefetch(context.Background()))
+
+	record, ok := cache.Load("http://example.com/index.html")
+	assert.True(t, ok)
+	assert.EqualValues(t, "old", string(record.Body))
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		Return(&http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString("new")),
+			ContentLength: 3,
+		}, nil)
+
+	assert.NoError(t, fc.Prefetch(context.Background())) // replaces the fresh copy
+
+	record, ok = cache.Load("http://example.com/index.html")
+	assert.True(t, ok)
+	assert.EqualValues(t, "new", string(record.Body))
+}
+
+func TestFetcherPrefetchProxy(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := NewMockCache(gomock.NewController(t)) // nothing is cached
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithProxy(nil))
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			assert.Equal(t, "http://example.com", request.URL.String())
+
+			return &http.Response{
+				StatusCode: http.StatusNotFound, // reachable, paths are checked per request
+				Body:       io.NopCloser(bytes.NewBufferString("not found")),
+			}, nil
+		})
+
+	assert.NoError(t, fc.Prefetch(context.Background()))
+
+	transport.EXPECT().RoundTrip(gomock.Any()).Return(nil, errors.New("connection refused"))
+
+	assert.ErrorContains(t, fc.Prefetch(context.Background()), "connection refused")
+}
+
+func TestFetcherConditionalRevalidation(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:        []byte("old"),
+		ContentType: "text/html",
+		StatusCode:  http.StatusOK,
+		Header: http.Header{
+			"Content-Type":  {"text/html"},
+			"Etag":          {`"v1"`},
+			"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		},
+		ExpiresAt: time.Now().Add(-time.Second),
+		Stale:     true,
+	})
+
+	accepted, err := traefik_fallback_plugin.ParseStatusMatcher("2xx")
+	assert.NoError(t, err)
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			assert.Equal(t, `"v1"`, request.Header.Get("If-None-Match"))
+			assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", request.Header.Get("If-Modified-Since"))
+
+			return &http.Response{
+				StatusCode: http.StatusNotModified,
+				Header:     http.Header{"Cache-Control": {"max-age=60"}},
+				Body:       io.NopCloser(bytes.NewBufferString("")),
+			}, nil
+		})
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second,
+		traefik_fallback_plugin.WithAcceptedStatusCodes(accepted))
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "old", string(record.Body))
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+	assert.Equal(t, "text/html", record.ContentType)
+	assert.Equal(t, `"v1"`, record.Header.Get("Etag"))
+	assert.Equal(t, "max-age=60", record.Header.Get("Cache-Control"))
+	assert.False(t, record.Stale)
+	assert.False(t, record.IsExpired())
+
+	cached, ok := cache.Load("http://example.com/index.html")
+	assert.True(t, ok)
+	assert.Equal(t, record, cached)
+}
+
+func TestFetcherConditionalRevalidationWithoutValidators(t *testing.T) {
+	transport := NewMockTransport(gomock.NewController(t))
+	cache := traefik_fallback_plugin.NewDefaultCache()
+
+	cache.Store("http://example.com/index.html", &traefik_fallback_plugin.CacheRecord{
+		Body:      []byte("old"),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	transport.EXPECT().RoundTrip(gomock.Any()).
+		DoAndReturn(func(request *http.Request) (*http.Response, error) {
+			assert.Empty(t, request.Header.Get("If-None-Match"))
+			assert.Empty(t, request.Header.Get("If-Modified-Since"))
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Body:          io.NopCloser(bytes.NewBufferString("new")),
+				ContentLength: 3,
+			}, nil
+		})
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		&http.Client{Transport: transport},
+		cache,
+		"http://example.com/index.html",
+		30*time.Second,
+		5*time.Second)
+
+	record, err := fc.Fetch(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "new", string(record.Body))
+}
+
+func TestFetcherConditionalRevalidationAgainstOrigin(t *testing.T) {
+	var full int32
+
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", `"v1"`)
+
+		if r.Header.Get("If-None-Match") == "" {
+			atomic.AddInt32(&full, 1)
+		}
+
+		http.ServeContent(w, r, "index.html", modTime, strings.NewReader("maintenance"))
+	}))
+	defer origin.Close()
+
+	fc := traefik_fallback_plugin.NewHttpFetcher(
+		origin.Client(),
+		traefik_fallback_plugin.NewDefaultCache(),
+		origin.URL,
+		time.Millisecond,
+		5*time.Second)
+
+	for i := 0; i < 3; i++ {
+		record, err := fc.Fetch(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "maintenance", string(record.Body))
+
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&full))
+}
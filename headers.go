@@ -0,0 +1,96 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// recordHeaders are kept from the fallback origin response and replayed on
+// fallback responses.
+var recordHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Disposition",
+	"Etag",
+	"Last-Modified",
+	"Cache-Control",
+	"Expires",
+}
+
+func filterRecordHeaders(src http.Header) http.Header {
+	dst := http.Header{}
+
+	for _, name := range recordHeaders {
+		if values := src.Values(name); len(values) > 0 {
+			dst[name] = append([]string(nil), values...)
+		}
+	}
+
+	return dst
+}
+
+func isValidatorHeader(name string) bool {
+	return name == "Etag" || name == "Last-Modified"
+}
+
+// responseHeaders are added to every fallback response.
+type responseHeaders struct {
+	static     map[string]string
+	retryAfter time.Duration
+	retryAt    time.Time
+}
+
+// newResponseHeaders accepts retryAfter either as a duration relative to the
+// response or as an RFC 3339 timestamp, e.g. the end of a maintenance window.
+func newResponseHeaders(static map[string]string, retryAfter string) (*responseHeaders, error) {
+	h := &responseHeaders{
+		static: static,
+	}
+
+	if retryAfter == "" {
+		return h, nil
+	}
+
+	if d, err := time.ParseDuration(retryAfter); err == nil {
+		if d < 0 {
+			return nil, fmt.Errorf("invalid retryAfter: %s", retryAfter)
+		}
+
+		h.retryAfter = d
+
+		return h, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, retryAfter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retryAfter: %s", retryAfter)
+	}
+
+	h.retryAt = at
+
+	return h, nil
+}
+
+func (h *responseHeaders) apply(header http.Header, now time.Time) {
+	for name, value := range h.static {
+		header.Set(name, value)
+	}
+
+	switch {
+	case h.retryAfter > 0:
+		header.Set("Retry-After", formatRetryAfter(h.retryAfter))
+	case !h.retryAt.IsZero():
+		if remaining := h.retryAt.Sub(now); remaining > 0 {
+			header.Set("Retry-After", formatRetryAfter(remaining))
+		}
+	}
+}
+
+func formatRetryAfter(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second) // round up
+
+	return strconv.FormatInt(seconds, 10)
+}
@@ -0,0 +1,87 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestFallbackResponseHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	cases := []struct {
+		name       string
+		retryAfter string
+		expected   func(t *testing.T, value string)
+	}{
+		{
+			name:       "duration",
+			retryAfter: "2m",
+			expected: func(t *testing.T, value string) {
+				assert.Equal(t, "120", value)
+			},
+		},
+		{
+			name:       "timestamp",
+			retryAfter: time.Now().Add(10 * time.Minute).UTC().Format(time.RFC3339),
+			expected: func(t *testing.T, value string) {
+				seconds, err := strconv.Atoi(value)
+				assert.NoError(t, err)
+				assert.InDelta(t, 600, seconds, 2)
+			},
+		},
+		{
+			name:       "timestamp in the past",
+			retryAfter: time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339),
+			expected: func(t *testing.T, value string) {
+				assert.Empty(t, value)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "503",
+				FallbackStatusCode:    "503",
+				FallbackBody:          "maintenance",
+				RetryAfter:            c.retryAfter,
+				FallbackHeaders: map[string]string{
+					"Cache-Control": "no-store",
+					"X-Maintenance": "1",
+				},
+			}, "test")
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			// Result only reports headers set before WriteHeader
+			resp := rec.Result()
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+			assert.Equal(t, "1", resp.Header.Get("X-Maintenance"))
+			c.expected(t, resp.Header.Get("Retry-After"))
+		})
+	}
+}
+
+func TestFallbackResponseHeadersInvalidRetryAfter(t *testing.T) {
+	for _, retryAfter := range []string{"soon", "-5s", "2024-13-01"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			RetryAfter: retryAfter,
+		}, "test")
+		assert.Error(t, err, retryAfter)
+	}
+}
@@ -8,10 +8,22 @@ import (
 //go:generate mockgen -destination interfaces_mocks_test.go -package traefik_fallback_plugin_test -source=interfaces.go
 
 type Fetcher interface {
+	Fetch(ctx context.Context, req *FetchRequest) (*CacheRecord, error)
+	CanFetch() bool
+}
+
+// ContextFetcher is the request agnostic fetcher shape, see AdaptContextFetcher.
+type ContextFetcher interface {
 	Fetch(ctx context.Context) (*CacheRecord, error)
 	CanFetch() bool
 }
 
+// Prefetcher is implemented by fetchers that can load their fallback content
+// before the first failing request, see Config.Prefetch.
+type Prefetcher interface {
+	Prefetch(ctx context.Context) error
+}
+
 type Cache interface {
 	Load(key string) (*CacheRecord, bool)
 	Store(key string, value *CacheRecord)
@@ -75,18 +75,18 @@ func (c *FetcherCanFetchCall) DoAndReturn(f func() bool) *FetcherCanFetchCall {
 }
 
 // Fetch mocks base method.
-func (m *MockFetcher) Fetch(ctx context.Context) (*traefik_fallback_plugin.CacheRecord, error) {
+func (m *MockFetcher) Fetch(ctx context.Context, req *traefik_fallback_plugin.FetchRequest) (*traefik_fallback_plugin.CacheRecord, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Fetch", ctx)
+	ret := m.ctrl.Call(m, "Fetch", ctx, req)
 	ret0, _ := ret[0].(*traefik_fallback_plugin.CacheRecord)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Fetch indicates an expected call of Fetch.
-func (mr *MockFetcherMockRecorder) Fetch(ctx interface{}) *FetcherFetchCall {
+func (mr *MockFetcherMockRecorder) Fetch(ctx, req interface{}) *FetcherFetchCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx, req)
 	return &FetcherFetchCall{Call: call}
 }
 
@@ -102,13 +102,174 @@ func (c *FetcherFetchCall) Return(arg0 *traefik_fallback_plugin.CacheRecord, arg
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *FetcherFetchCall) Do(f func(context.Context) (*traefik_fallback_plugin.CacheRecord, error)) *FetcherFetchCall {
+func (c *FetcherFetchCall) Do(f func(context.Context, *traefik_fallback_plugin.FetchRequest) (*traefik_fallback_plugin.CacheRecord, error)) *FetcherFetchCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *FetcherFetchCall) DoAndReturn(f func(context.Context, *traefik_fallback_plugin.FetchRequest) (*traefik_fallback_plugin.CacheRecord, error)) *FetcherFetchCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockContextFetcher is a mock of ContextFetcher interface.
+type MockContextFetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockContextFetcherMockRecorder
+}
+
+// MockContextFetcherMockRecorder is the mock recorder for MockContextFetcher.
+type MockContextFetcherMockRecorder struct {
+	mock *MockContextFetcher
+}
+
+// NewMockContextFetcher creates a new mock instance.
+func NewMockContextFetcher(ctrl *gomock.Controller) *MockContextFetcher {
+	mock := &MockContextFetcher{ctrl: ctrl}
+	mock.recorder = &MockContextFetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockContextFetcher) EXPECT() *MockContextFetcherMockRecorder {
+	return m.recorder
+}
+
+// CanFetch mocks base method.
+func (m *MockContextFetcher) CanFetch() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CanFetch")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// CanFetch indicates an expected call of CanFetch.
+func (mr *MockContextFetcherMockRecorder) CanFetch() *ContextFetcherCanFetchCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanFetch", reflect.TypeOf((*MockContextFetcher)(nil).CanFetch))
+	return &ContextFetcherCanFetchCall{Call: call}
+}
+
+// ContextFetcherCanFetchCall wrap *gomock.Call
+type ContextFetcherCanFetchCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ContextFetcherCanFetchCall) Return(arg0 bool) *ContextFetcherCanFetchCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ContextFetcherCanFetchCall) Do(f func() bool) *ContextFetcherCanFetchCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ContextFetcherCanFetchCall) DoAndReturn(f func() bool) *ContextFetcherCanFetchCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Fetch mocks base method.
+func (m *MockContextFetcher) Fetch(ctx context.Context) (*traefik_fallback_plugin.CacheRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx)
+	ret0, _ := ret[0].(*traefik_fallback_plugin.CacheRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockContextFetcherMockRecorder) Fetch(ctx interface{}) *ContextFetcherFetchCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockContextFetcher)(nil).Fetch), ctx)
+	return &ContextFetcherFetchCall{Call: call}
+}
+
+// ContextFetcherFetchCall wrap *gomock.Call
+type ContextFetcherFetchCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ContextFetcherFetchCall) Return(arg0 *traefik_fallback_plugin.CacheRecord, arg1 error) *ContextFetcherFetchCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ContextFetcherFetchCall) Do(f func(context.Context) (*traefik_fallback_plugin.CacheRecord, error)) *ContextFetcherFetchCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ContextFetcherFetchCall) DoAndReturn(f func(context.Context) (*traefik_fallback_plugin.CacheRecord, error)) *ContextFetcherFetchCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockPrefetcher is a mock of Prefetcher interface.
+type MockPrefetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockPrefetcherMockRecorder
+}
+
+// MockPrefetcherMockRecorder is the mock recorder for MockPrefetcher.
+type MockPrefetcherMockRecorder struct {
+	mock *MockPrefetcher
+}
+
+// NewMockPrefetcher creates a new mock instance.
+func NewMockPrefetcher(ctrl *gomock.Controller) *MockPrefetcher {
+	mock := &MockPrefetcher{ctrl: ctrl}
+	mock.recorder = &MockPrefetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPrefetcher) EXPECT() *MockPrefetcherMockRecorder {
+	return m.recorder
+}
+
+// Prefetch mocks base method.
+func (m *MockPrefetcher) Prefetch(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prefetch", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prefetch indicates an expected call of Prefetch.
+func (mr *MockPrefetcherMockRecorder) Prefetch(ctx interface{}) *PrefetcherPrefetchCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prefetch", reflect.TypeOf((*MockPrefetcher)(nil).Prefetch), ctx)
+	return &PrefetcherPrefetchCall{Call: call}
+}
+
+// PrefetcherPrefetchCall wrap *gomock.Call
+type PrefetcherPrefetchCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *PrefetcherPrefetchCall) Return(arg0 error) *PrefetcherPrefetchCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *PrefetcherPrefetchCall) Do(f func(context.Context) error) *PrefetcherPrefetchCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *FetcherFetchCall) DoAndReturn(f func(context.Context) (*traefik_fallback_plugin.CacheRecord, error)) *FetcherFetchCall {
+func (c *PrefetcherPrefetchCall) DoAndReturn(f func(context.Context) error) *PrefetcherPrefetchCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -0,0 +1,70 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const defaultLastResortPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Service Unavailable</title>
+</head>
+<body>
+<h1>Service Unavailable</h1>
+<p>The service is temporarily unavailable. Please try again later.</p>
+</body>
+</html>
+`
+
+// lastResortResponse is served when the fallback content itself can not be
+// fetched.
+type lastResortResponse struct {
+	statusCode  int
+	contentType string
+	headers     map[string]string
+	body        []byte
+}
+
+func newLastResortResponse(config *Config) (*lastResortResponse, error) {
+	l := &lastResortResponse{
+		statusCode:  http.StatusServiceUnavailable,
+		contentType: config.LastResortContentType,
+		headers:     config.LastResortHeaders,
+		body:        []byte(config.LastResortBody),
+	}
+
+	if config.LastResortStatusCode != "" {
+		statusCode, err := parseStatusCode(config.LastResortStatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lastResortStatusCode: %w", err)
+		}
+
+		l.statusCode = statusCode
+	}
+
+	if config.LastResortBody == "" {
+		if l.contentType != "" { // the built-in page is always HTML
+			return nil, fmt.Errorf("lastResortContentType requires lastResortBody")
+		}
+
+		l.body = []byte(defaultLastResortPage)
+		l.contentType = "text/html; charset=utf-8"
+	}
+
+	return l, nil
+}
+
+func (l *lastResortResponse) write(rw http.ResponseWriter) {
+	for name, value := range l.headers {
+		rw.Header().Set(name, value)
+	}
+
+	if l.contentType != "" {
+		rw.Header().Set("Content-Type", l.contentType)
+	}
+
+	rw.WriteHeader(l.statusCode)
+	_, _ = rw.Write(l.body)
+}
@@ -2,8 +2,13 @@ package traefik_fallback_plugin
 
 import "sync"
 
+type keyLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters, the lock is dropped once it reaches zero
+}
+
 type StringKeyLock struct {
-	locks map[string]*sync.Mutex
+	locks map[string]*keyLock
 
 	mapLock sync.Mutex // to make the map safe concurrently
 }
@@ -11,27 +16,47 @@ type StringKeyLock struct {
 var DefaultMutex = NewStringKeyLock()
 
 func NewStringKeyLock() *StringKeyLock {
-	return &StringKeyLock{locks: make(map[string]*sync.Mutex)}
+	return &StringKeyLock{locks: make(map[string]*keyLock)}
 }
 
-func (l *StringKeyLock) getLockBy(key string) *sync.Mutex {
+func (l *StringKeyLock) Lock(key string) {
 	l.mapLock.Lock()
-	defer l.mapLock.Unlock()
 
-	ret, found := l.locks[key]
-	if found {
-		return ret
+	lock, found := l.locks[key]
+	if !found {
+		lock = &keyLock{}
+		l.locks[key] = lock
 	}
 
-	ret = &sync.Mutex{}
-	l.locks[key] = ret
-	return ret
-}
+	lock.refs++
+	l.mapLock.Unlock()
 
-func (l *StringKeyLock) Lock(key string) {
-	l.getLockBy(key).Lock()
+	lock.mu.Lock()
 }
 
 func (l *StringKeyLock) Unlock(key string) {
-	l.getLockBy(key).Unlock()
+	l.mapLock.Lock()
+
+	lock, found := l.locks[key]
+	if !found {
+		l.mapLock.Unlock()
+		panic("traefik_fallback_plugin: unlock of unlocked key " + key)
+	}
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+
+	l.mapLock.Unlock()
+
+	lock.mu.Unlock()
+}
+
+// Len returns the number of keys currently locked or waited on.
+func (l *StringKeyLock) Len() int {
+	l.mapLock.Lock()
+	defer l.mapLock.Unlock()
+
+	return len(l.locks)
 }
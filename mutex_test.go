@@ -0,0 +1,42 @@
+package traefik_fallback_plugin_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestStringKeyLockReleasesKeys(t *testing.T) {
+	l := traefik_fallback_plugin.NewStringKeyLock()
+
+	var (
+		wg      sync.WaitGroup
+		counter int
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			l.Lock("key")
+			counter++
+			l.Unlock("key")
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 50, counter)
+	assert.Equal(t, 0, l.Len())
+}
+
+func TestStringKeyLockUnlockWithoutLock(t *testing.T) {
+	assert.Panics(t, func() {
+		traefik_fallback_plugin.NewStringKeyLock().Unlock("key")
+	})
+}
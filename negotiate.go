@@ -0,0 +1,189 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variant is a fallback alternative picked by negotiating on the request
+// Accept header.
+type Variant struct {
+	ContentType        string `json:"contentType,omitempty"`
+	FallbackURL        string `json:"fallbackURL,omitempty"`
+	FallbackBody       string `json:"fallbackBody,omitempty"`
+	FallbackBodyBase64 string `json:"fallbackBodyBase64,omitempty"`
+	FallbackFile       string `json:"fallbackFile,omitempty"`
+	FallbackStatusCode string `json:"fallbackStatusCode,omitempty"`
+	Default            bool   `json:"default,omitempty"`
+}
+
+type fallbackVariant struct {
+	mediaType string
+	target    *fallbackTarget
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func (f *Fallback) newVariants(configs []Variant, parent *fallbackTarget) ([]*fallbackVariant, error) {
+	var variants []*fallbackVariant
+
+	defaultIndex := -1
+
+	for i, config := range configs {
+		mediaType, _, err := mime.ParseMediaType(config.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid variant %d content type: %s", i, config.ContentType)
+		}
+
+		src := fetcherSource{
+			url:         config.FallbackURL,
+			body:        config.FallbackBody,
+			bodyBase64:  config.FallbackBodyBase64,
+			file:        config.FallbackFile,
+			contentType: config.ContentType,
+		}
+
+		if src.isEmpty() {
+			return nil, fmt.Errorf("variant %d has no fallback source", i)
+		}
+
+		fetcher, fetcherErr := f.newFetcher(src)
+		if fetcherErr != nil {
+			return nil, fmt.Errorf("invalid variant %d: %w", i, fetcherErr)
+		}
+
+		target := &fallbackTarget{
+			fetcher:     fetcher,
+			statusCode:  parent.statusCode,
+			contentType: config.ContentType,
+		}
+
+		if config.FallbackStatusCode != "" {
+			statusCode, statusErr := parseStatusCode(config.FallbackStatusCode)
+			if statusErr != nil {
+				return nil, fmt.Errorf("invalid variant %d status code: %w", i, statusErr)
+			}
+
+			target.statusCode = statusCode
+		}
+
+		if config.Default {
+			if defaultIndex >= 0 {
+				return nil, fmt.Errorf("variants %d and %d are both marked as default", defaultIndex, i)
+			}
+
+			defaultIndex = i
+		}
+
+		variants = append(variants, &fallbackVariant{
+			mediaType: mediaType,
+			target:    target,
+		})
+	}
+
+	if defaultIndex > 0 { // keep the default variant first
+		def := variants[defaultIndex]
+		copy(variants[1:defaultIndex+1], variants[:defaultIndex])
+		variants[0] = def
+	}
+
+	return variants, nil
+}
+
+// negotiate picks the variant best matching the request Accept header. The
+// second result reports whether the response depends on the Accept header.
+func (t *fallbackTarget) negotiate(req *http.Request) (*fallbackTarget, bool) {
+	if len(t.variants) == 0 {
+		return t, false
+	}
+
+	accept := parseAccept(req.Header.Get("Accept"))
+	if len(accept) == 0 {
+		return t.variants[0].target, true
+	}
+
+	var best *fallbackVariant
+	bestQ := 0.0
+
+	for _, v := range t.variants {
+		if q := acceptQuality(accept, v.mediaType); q > bestQ {
+			best = v
+			bestQ = q
+		}
+	}
+
+	if best == nil {
+		return t.variants[0].target, true
+	}
+
+	return best.target, true
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+
+		if rawQ, ok := params["q"]; ok {
+			parsed, parseErr := strconv.ParseFloat(rawQ, 64)
+			if parseErr != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+
+			q = parsed
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	// most specific ranges first, so they take precedence over wildcards
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+
+	return ranges
+}
+
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	for _, r := range ranges {
+		switch {
+		case r.mediaType == mediaType,
+			r.mediaType == typ+"/*",
+			r.mediaType == "*/*":
+			return r.q
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,151 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestNegotiation(t *testing.T) {
+	htmlSrv := newContentServer(t, "text/html", "<h1>down</h1>")
+	jsonSrv := newContentServer(t, "application/json", `{"error":"down"}`)
+	textSrv := newContentServer(t, "text/plain", "down")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "503",
+		FallbackStatusCode:    "503",
+		Variants: []traefik_fallback_plugin.Variant{
+			{ContentType: "application/json", FallbackURL: jsonSrv.URL},
+			{ContentType: "text/html; charset=utf-8", FallbackURL: htmlSrv.URL, Default: true},
+			{ContentType: "text/plain", FallbackURL: textSrv.URL, FallbackStatusCode: "500"},
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		accept      string
+		code        int
+		body        string
+		contentType string
+	}{
+		{
+			name:        "no accept header uses default",
+			code:        http.StatusServiceUnavailable,
+			body:        "<h1>down</h1>",
+			contentType: "text/html; charset=utf-8",
+		},
+		{
+			name:        "browser",
+			accept:      "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			code:        http.StatusServiceUnavailable,
+			body:        "<h1>down</h1>",
+			contentType: "text/html; charset=utf-8",
+		},
+		{
+			name:        "api client",
+			accept:      "application/json",
+			code:        http.StatusServiceUnavailable,
+			body:        `{"error":"down"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "q values",
+			accept:      "text/html;q=0.2, application/json;q=0.5, text/plain;q=0.9",
+			code:        http.StatusInternalServerError,
+			body:        "down",
+			contentType: "text/plain",
+		},
+		{
+			name:        "specific range beats wildcard",
+			accept:      "text/*;q=0.1, text/plain;q=0, application/*;q=0.5",
+			code:        http.StatusServiceUnavailable,
+			body:        `{"error":"down"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "nothing acceptable uses default",
+			accept:      "image/png",
+			code:        http.StatusServiceUnavailable,
+			body:        "<h1>down</h1>",
+			contentType: "text/html; charset=utf-8",
+		},
+		{
+			name:        "wildcard prefers default",
+			accept:      "*/*",
+			code:        http.StatusServiceUnavailable,
+			body:        "<h1>down</h1>",
+			contentType: "text/html; charset=utf-8",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
+			}
+
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			assert.Equal(t, c.code, rec.Code)
+			assert.Equal(t, c.body, rec.Body.String())
+			assert.Equal(t, c.contentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestNegotiationInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		variants []traefik_fallback_plugin.Variant
+		err      string
+	}{
+		{
+			name:     "content type",
+			variants: []traefik_fallback_plugin.Variant{{ContentType: "", FallbackURL: "http://example.com"}},
+			err:      "invalid variant 0 content type",
+		},
+		{
+			name:     "missing url",
+			variants: []traefik_fallback_plugin.Variant{{ContentType: "text/html"}},
+			err:      "variant 0 has no fallback source",
+		},
+		{
+			name:     "status code",
+			variants: []traefik_fallback_plugin.Variant{{ContentType: "text/html", FallbackURL: "http://example.com", FallbackStatusCode: "0"}},
+			err:      "invalid variant 0 status code",
+		},
+		{
+			name: "two defaults",
+			variants: []traefik_fallback_plugin.Variant{
+				{ContentType: "text/html", FallbackURL: "http://example.com", Default: true},
+				{ContentType: "text/plain", FallbackURL: "http://example.com", Default: true},
+			},
+			err: "both marked as default",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "500",
+				Variants:              c.variants,
+			}, "test")
+
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
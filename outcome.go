@@ -0,0 +1,45 @@
+package traefik_fallback_plugin
+
+import (
+	"context"
+	"net/http"
+)
+
+// UpstreamOutcome describes what happened to the upstream call that made the
+// fallback necessary.
+type UpstreamOutcome struct {
+	// StatusCode is the status written by the upstream, 0 if none was written.
+	StatusCode int
+	TimedOut   bool
+	Panicked   bool
+	PanicValue interface{}
+}
+
+// FetchRequest is passed to a Fetcher for every fallback that is served.
+type FetchRequest struct {
+	// Request is the original client request.
+	Request *http.Request
+	Outcome UpstreamOutcome
+	// ContentType is the content type negotiated for the fallback, if any.
+	ContentType string
+}
+
+type contextFetcherAdapter struct {
+	fetcher ContextFetcher
+}
+
+// AdaptContextFetcher wraps a fetcher that does not look at the request.
+func AdaptContextFetcher(fetcher ContextFetcher) Fetcher {
+	return &contextFetcherAdapter{fetcher: fetcher}
+}
+
+func (a *contextFetcherAdapter) CanFetch() bool {
+	return a.fetcher.CanFetch()
+}
+
+func (a *contextFetcherAdapter) Fetch(
+	ctx context.Context,
+	_ *FetchRequest,
+) (*CacheRecord, error) {
+	return a.fetcher.Fetch(ctx)
+}
@@ -0,0 +1,94 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestAdaptContextFetcher(t *testing.T) {
+	legacy := NewMockContextFetcher(gomock.NewController(t))
+	rec := &traefik_fallback_plugin.CacheRecord{Body: []byte("legacy")}
+
+	legacy.EXPECT().CanFetch().Return(true)
+	legacy.EXPECT().Fetch(gomock.Any()).Return(rec, nil)
+
+	fc := traefik_fallback_plugin.AdaptContextFetcher(legacy)
+
+	assert.True(t, fc.CanFetch())
+
+	resp, err := fc.Fetch(context.TODO(), &traefik_fallback_plugin.FetchRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, rec, resp)
+}
+
+func TestFetchRequestOutcome(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		outcome traefik_fallback_plugin.UpstreamOutcome
+	}{
+		{
+			name: "status code",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			outcome: traefik_fallback_plugin.UpstreamOutcome{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			outcome: traefik_fallback_plugin.UpstreamOutcome{TimedOut: true},
+		},
+		{
+			name: "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("oops")
+			},
+			outcome: traefik_fallback_plugin.UpstreamOutcome{Panicked: true, PanicValue: "oops"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fallback, err := traefik_fallback_plugin.New(context.Background(), c.handler, &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "5xx",
+				FallbackURL:           "http://example.com",
+				UpstreamTimeout:       "20ms",
+			}, "test")
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/orders?id=1", nil)
+
+			fetcher := NewMockFetcher(gomock.NewController(t))
+			fetcher.EXPECT().CanFetch().Return(true)
+			fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, fetchReq *traefik_fallback_plugin.FetchRequest) (*traefik_fallback_plugin.CacheRecord, error) {
+					assert.Same(t, req, fetchReq.Request)
+					assert.Equal(t, c.outcome, fetchReq.Outcome)
+
+					return &traefik_fallback_plugin.CacheRecord{Body: []byte("fallback")}, nil
+				})
+
+			fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+			fallback.(*traefik_fallback_plugin.Fallback).SetPanicHandler(func(value interface{}, stack []byte) {})
+
+			rec := httptest.NewRecorder()
+
+			start := time.Now()
+			fallback.ServeHTTP(rec, req)
+
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, "fallback", rec.Body.String())
+		})
+	}
+}
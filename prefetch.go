@@ -0,0 +1,79 @@
+package traefik_fallback_plugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// prefetchers returns the distinct fetchers of all targets that support
+// prefetching.
+func (f *Fallback) prefetchers() []Prefetcher {
+	targets := []*fallbackTarget{f.defaultTarget}
+	for _, r := range f.rules {
+		targets = append(targets, r.target)
+	}
+
+	var prefetchers []Prefetcher
+
+	seen := map[Prefetcher]struct{}{}
+
+	add := func(fetcher Fetcher) {
+		p, ok := fetcher.(Prefetcher)
+		if !ok {
+			return
+		}
+
+		if _, ok = seen[p]; ok {
+			return
+		}
+
+		seen[p] = struct{}{}
+		prefetchers = append(prefetchers, p)
+	}
+
+	for _, target := range targets {
+		add(target.fetcher)
+
+		for _, variant := range target.variants {
+			add(variant.target.fetcher)
+		}
+	}
+
+	return prefetchers
+}
+
+// prefetch warms all prefetchers. Failures are logged, or returned when
+// required is set.
+func (f *Fallback) prefetch(ctx context.Context, prefetchers []Prefetcher, required bool) error {
+	for _, p := range prefetchers {
+		err := p.Prefetch(ctx)
+		if err == nil {
+			continue
+		}
+
+		if required {
+			return fmt.Errorf("fallback prefetch failed: %w", err)
+		}
+
+		log.Printf("[%s] fallback prefetch failed: %v", f.name, err)
+	}
+
+	return nil
+}
+
+// refreshPeriodically prefetches on every interval until ctx is done.
+func (f *Fallback) refreshPeriodically(ctx context.Context, prefetchers []Prefetcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = f.prefetch(ctx, prefetchers, false)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func newCountingOrigin(body string) (*httptest.Server, *int32) {
+	var hits int32
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte(body))
+	}))
+
+	return origin, &hits
+}
+
+func TestPrefetchAtStartup(t *testing.T) {
+	origin, hits := newCountingOrigin("maintenance")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		Prefetch:              true,
+	}, "test")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(hits))
+
+	origin.Close() // the fallback origin fails together with the backend
+
+	rec := httptest.NewRecorder()
+	fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "maintenance", rec.Body.String())
+}
+
+func TestPrefetchSharedBetweenRules(t *testing.T) {
+	origin, hits := newCountingOrigin("maintenance")
+	defer origin.Close()
+
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		Prefetch:              true,
+		Variants: []traefik_fallback_plugin.Variant{
+			{ContentType: "application/json", FallbackBody: `{"error":"maintenance"}`},
+			{ContentType: "text/html", FallbackURL: origin.URL + "/index.html", Default: true},
+		},
+		Rules: []traefik_fallback_plugin.Rule{
+			{PathPrefix: "/api", FallbackBody: "api maintenance"},
+			{PathPrefix: "/app", FallbackStatusCode: "503"}, // inherits the top level source
+			{Host: "admin.example.com"},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(hits)) // the top level URL and the HTML variant
+}
+
+func TestPrefetchInheritingRuleSharesFetcher(t *testing.T) {
+	origin, hits := newCountingOrigin("maintenance")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		Prefetch:              true,
+		Rules: []traefik_fallback_plugin.Rule{
+			{PathPrefix: "/app", FallbackStatusCode: "503"},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(hits))
+
+	origin.Close()
+
+	rec := httptest.NewRecorder()
+	fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/orders", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "maintenance", rec.Body.String())
+}
+
+func TestPrefetchUnreachable(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	origin.Close()
+
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		Prefetch:              true,
+	}, "test")
+	assert.NoError(t, err)
+
+	_, err = traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		PrefetchRequired:      true,
+	}, "test")
+	assert.ErrorContains(t, err, "fallback prefetch failed")
+}
+
+func TestPrefetchRequiredPerRequestFallback(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	reachable, hits := newCountingOrigin("mirror")
+	defer reachable.Close()
+
+	for name, config := range map[string]traefik_fallback_plugin.Config{
+		"proxy":        {FallbackProxy: true},
+		"key template": {CacheKeyTemplate: "{path}"},
+	} {
+		config := config
+		config.FallbackOnStatusCodes = "502"
+		config.PrefetchRequired = true
+
+		config.FallbackURL = unreachable.URL
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &config, "test")
+		assert.ErrorContains(t, err, "fallback prefetch failed", name)
+
+		config.FallbackURL = reachable.URL
+		_, err = traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &config, "test")
+		assert.NoError(t, err, name)
+	}
+
+	assert.EqualValues(t, 2, atomic.LoadInt32(hits))
+}
+
+func TestPrefetchRequiredMissingFile(t *testing.T) {
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackFile:          filepath.Join(t.TempDir(), "missing.html"),
+		PrefetchRequired:      true,
+	}, "test")
+	assert.ErrorContains(t, err, "fallback prefetch failed")
+}
+
+func TestPrefetchInterval(t *testing.T) {
+	origin, hits := newCountingOrigin("maintenance")
+	defer origin.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := traefik_fallback_plugin.New(ctx, http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "502",
+		FallbackURL:           origin.URL,
+		PrefetchInterval:      "10ms",
+	}, "test")
+	assert.NoError(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(hits) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.GreaterOrEqual(t, atomic.LoadInt32(hits), int32(3))
+
+	cancel()
+	time.Sleep(50 * time.Millisecond) // let an in-flight refresh finish
+
+	stopped := atomic.LoadInt32(hits)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, stopped, atomic.LoadInt32(hits))
+}
+
+func TestNewFallbackInvalidPrefetchInterval(t *testing.T) {
+	for _, interval := range []string{"abc", "0s", "-1s"} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+			PrefetchInterval: interval,
+		}, "test")
+
+		assert.Error(t, err, interval)
+	}
+}
@@ -0,0 +1,164 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Rule selects a dedicated fallback for matching requests. All non-empty
+// matchers must match. Empty fallback settings inherit the top level ones.
+type Rule struct {
+	PathPrefix           string    `json:"pathPrefix,omitempty"`
+	PathRegex            string    `json:"pathRegex,omitempty"`
+	Host                 string    `json:"host,omitempty"`
+	Method               string    `json:"method,omitempty"`
+	Accept               string    `json:"accept,omitempty"`
+	FallbackURL          string    `json:"fallbackURL,omitempty"`
+	FallbackStatusCode   string    `json:"fallbackStatusCode,omitempty"`
+	FallbackContentType  string    `json:"fallbackContentType,omitempty"`
+	FallbackBody         string    `json:"fallbackBody,omitempty"`
+	FallbackBodyBase64   string    `json:"fallbackBodyBase64,omitempty"`
+	FallbackFile         string    `json:"fallbackFile,omitempty"`
+	FallbackDir          string    `json:"fallbackDir,omitempty"`
+	FallbackDirIndex     string    `json:"fallbackDirIndex,omitempty"`
+	FallbackDirSPA       bool      `json:"fallbackDirSPA,omitempty"`
+	FallbackProxy        bool      `json:"fallbackProxy,omitempty"`
+	FallbackProxyHeaders string    `json:"fallbackProxyHeaders,omitempty"`
+	Variants             []Variant `json:"variants,omitempty"`
+}
+
+type fallbackTarget struct {
+	fetcher     Fetcher
+	statusCode  int
+	contentType string
+	variants    []*fallbackVariant
+}
+
+type rule struct {
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	host       string
+	methods    map[string]struct{}
+	accept     string
+	target     *fallbackTarget
+}
+
+func (f *Fallback) newRule(config Rule) (*rule, error) {
+	r := &rule{
+		pathPrefix: config.PathPrefix,
+		host:       strings.ToLower(strings.TrimSpace(config.Host)),
+		accept:     strings.ToLower(strings.TrimSpace(config.Accept)),
+	}
+
+	if config.PathRegex != "" {
+		re, err := regexp.Compile(config.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pathRegex: %w", err)
+		}
+
+		r.pathRegex = re
+	}
+
+	if config.Method != "" {
+		r.methods = map[string]struct{}{}
+
+		for _, method := range strings.Split(config.Method, ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if method == "" {
+				return nil, fmt.Errorf("invalid method: %s", config.Method)
+			}
+
+			r.methods[method] = struct{}{}
+		}
+	}
+
+	target := &fallbackTarget{
+		statusCode:  f.defaultTarget.statusCode,
+		contentType: f.defaultTarget.contentType,
+	}
+
+	src := fetcherSource{
+		url:         config.FallbackURL,
+		body:        config.FallbackBody,
+		bodyBase64:  config.FallbackBodyBase64,
+		file:        config.FallbackFile,
+		dir:         config.FallbackDir,
+		dirIndex:    config.FallbackDirIndex,
+		dirSPA:      config.FallbackDirSPA,
+		proxy:       config.FallbackProxy,
+		proxyHeader: config.FallbackProxyHeaders,
+		contentType: config.FallbackContentType,
+	}
+
+	if src.isEmpty() { // share the top level fetcher and its cached content
+		target.fetcher = f.defaultTarget.fetcher
+	} else {
+		fetcher, err := f.newFetcher(src)
+		if err != nil {
+			return nil, err
+		}
+
+		target.fetcher = fetcher
+	}
+
+	if config.FallbackStatusCode != "" {
+		statusCode, err := parseStatusCode(config.FallbackStatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback status code: %w", err)
+		}
+
+		target.statusCode = statusCode
+	}
+
+	if config.FallbackContentType != "" {
+		target.contentType = config.FallbackContentType
+	}
+
+	variants, err := f.newVariants(config.Variants, target)
+	if err != nil {
+		return nil, err
+	}
+
+	target.variants = variants
+	r.target = target
+
+	return r, nil
+}
+
+func (r *rule) matches(req *http.Request) bool {
+	if r.pathPrefix != "" && !strings.HasPrefix(req.URL.Path, r.pathPrefix) {
+		return false
+	}
+
+	if r.pathRegex != nil && !r.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+
+	if r.host != "" && r.host != requestHost(req) {
+		return false
+	}
+
+	if r.methods != nil {
+		if _, ok := r.methods[req.Method]; !ok {
+			return false
+		}
+	}
+
+	if r.accept != "" && !strings.Contains(strings.ToLower(req.Header.Get("Accept")), r.accept) {
+		return false
+	}
+
+	return true
+}
+
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
@@ -0,0 +1,155 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func newContentServer(t *testing.T, contentType string, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestRules(t *testing.T) {
+	htmlSrv := newContentServer(t, "text/html", "<h1>down</h1>")
+	jsonSrv := newContentServer(t, "application/json", `{"error":"down"}`)
+	adminSrv := newContentServer(t, "text/plain", "admin down")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           htmlSrv.URL,
+		FallbackStatusCode:    "200",
+		Rules: []traefik_fallback_plugin.Rule{
+			{
+				PathPrefix:         "/api",
+				Method:             "GET, post",
+				FallbackURL:        jsonSrv.URL,
+				FallbackStatusCode: "503",
+			},
+			{
+				Host:        "admin.example.com",
+				PathRegex:   `^/(settings|users)/\d+$`,
+				FallbackURL: adminSrv.URL,
+			},
+			{
+				Accept:              "application/json",
+				FallbackURL:         jsonSrv.URL,
+				FallbackContentType: "application/problem+json",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		accept      string
+		code        int
+		body        string
+		contentType string
+		vary        string
+	}{
+		{
+			name:        "path prefix and method",
+			method:      http.MethodPost,
+			target:      "http://example.com/api/orders",
+			code:        http.StatusServiceUnavailable,
+			body:        `{"error":"down"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "method mismatch falls through to default",
+			method:      http.MethodDelete,
+			target:      "http://example.com/api/orders",
+			code:        http.StatusOK,
+			body:        "<h1>down</h1>",
+			contentType: "text/html",
+			vary:        "Accept",
+		},
+		{
+			name:        "host and regex",
+			method:      http.MethodGet,
+			target:      "http://admin.example.com:8443/users/42",
+			code:        http.StatusOK,
+			body:        "admin down",
+			contentType: "text/plain",
+		},
+		{
+			name:        "regex mismatch",
+			method:      http.MethodGet,
+			target:      "http://admin.example.com/users/abc",
+			code:        http.StatusOK,
+			body:        "<h1>down</h1>",
+			contentType: "text/html",
+			vary:        "Accept",
+		},
+		{
+			name:        "accept header",
+			method:      http.MethodGet,
+			target:      "http://example.com/page",
+			accept:      "application/json, */*;q=0.1",
+			code:        http.StatusOK,
+			body:        `{"error":"down"}`,
+			contentType: "application/problem+json",
+			vary:        "Accept",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.target, nil)
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
+			}
+
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			assert.Equal(t, c.code, rec.Code)
+			assert.Equal(t, c.body, rec.Body.String())
+			assert.Equal(t, c.contentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, c.vary, rec.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestRulesInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name string
+		rule traefik_fallback_plugin.Rule
+	}{
+		{name: "regex", rule: traefik_fallback_plugin.Rule{PathRegex: "(["}},
+		{name: "status code", rule: traefik_fallback_plugin.Rule{FallbackStatusCode: "abc"}},
+		{name: "status code zero", rule: traefik_fallback_plugin.Rule{FallbackStatusCode: "0"}},
+		{name: "status code out of range", rule: traefik_fallback_plugin.Rule{FallbackStatusCode: "1000"}},
+		{name: "method", rule: traefik_fallback_plugin.Rule{Method: "GET,,POST"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "500",
+				Rules:                 []traefik_fallback_plugin.Rule{c.rule},
+			}, "test")
+
+			assert.ErrorContains(t, err, "invalid rule 0")
+		})
+	}
+}
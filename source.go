@@ -0,0 +1,105 @@
+package traefik_fallback_plugin
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fetcherSource describes where fallback content comes from.
+type fetcherSource struct {
+	url         string
+	body        string
+	bodyBase64  string
+	file        string
+	dir         string
+	dirIndex    string
+	dirSPA      bool
+	proxy       bool
+	proxyHeader string
+	contentType string
+}
+
+func (s fetcherSource) isEmpty() bool {
+	return s.url == "" && s.body == "" && s.bodyBase64 == "" && s.file == "" && s.dir == ""
+}
+
+func (f *Fallback) newFetcher(src fetcherSource) (Fetcher, error) {
+	if src.body != "" && src.bodyBase64 != "" {
+		return nil, fmt.Errorf("fallbackBody and fallbackBodyBase64 are mutually exclusive")
+	}
+
+	switch {
+	case src.body != "":
+		return NewStaticFetcher([]byte(src.body), src.contentType), nil
+	case src.bodyBase64 != "":
+		body, err := base64.StdEncoding.DecodeString(src.bodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallbackBodyBase64: %w", err)
+		}
+
+		return NewStaticFetcher(body, src.contentType), nil
+	case src.file != "":
+		return NewFileFetcher(f.cache, src.file, src.contentType), nil
+	case src.dir != "":
+		return NewDirFetcher(f.requestCache, src.dir, src.dirIndex, src.dirSPA), nil
+	default:
+		opts := []HttpFetcherOption{WithName(f.name)}
+
+		if src.proxy {
+			opts = append(opts, WithProxy(splitList(src.proxyHeader)))
+		}
+
+		if f.maxFallbackBodySize > 0 {
+			opts = append(opts, WithMaxBodySize(f.maxFallbackBodySize))
+		}
+
+		if !f.acceptedStatus.IsEmpty() {
+			opts = append(opts, WithAcceptedStatusCodes(f.acceptedStatus))
+		}
+
+		if f.staleIfError > 0 {
+			opts = append(opts, WithStaleIfError(f.staleIfError))
+		}
+
+		if f.staleRevalidate > 0 {
+			opts = append(opts, WithStaleWhileRevalidate(f.staleRevalidate))
+		}
+
+		if f.honorCacheControl {
+			opts = append(opts, WithOriginCacheControl(f.minCacheTTL, f.maxCacheTTL))
+		}
+
+		if f.cacheKeyTemplate != nil {
+			opts = append(opts, WithCacheKeyTemplate(f.cacheKeyTemplate))
+		}
+
+		// keys derived from the request never evict fixed fallback content
+		cache := f.cache
+		if src.proxy || f.cacheKeyTemplate != nil {
+			cache = f.requestCache
+		}
+
+		return NewHttpFetcher(
+			http.DefaultClient,
+			cache,
+			src.url,
+			f.cacheTTL,
+			f.timeout,
+			opts...,
+		), nil
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,146 @@
+package traefik_fallback_plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	minStatusCode = 100
+	maxStatusCode = 599
+)
+
+type statusRange struct {
+	from int
+	to   int
+}
+
+func (r statusRange) contains(code int) bool {
+	return code >= r.from && code <= r.to
+}
+
+// StatusMatcher matches HTTP status codes against a comma separated list of
+// codes (500), ranges (500-599), classes (5xx) and exclusions (!501).
+type StatusMatcher struct {
+	include []statusRange
+	exclude []statusRange
+}
+
+// ParseStatusMatcher compiles a status code expression. An empty expression
+// yields a matcher that matches nothing.
+func ParseStatusMatcher(expr string) (*StatusMatcher, error) {
+	m := &StatusMatcher{}
+
+	if strings.TrimSpace(expr) == "" {
+		return m, nil
+	}
+
+	for _, token := range strings.Split(expr, ",") {
+		token = strings.TrimSpace(token)
+
+		negate := strings.HasPrefix(token, "!")
+		if negate {
+			token = strings.TrimSpace(token[1:])
+		}
+
+		r, err := parseStatusRange(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if negate {
+			m.exclude = append(m.exclude, r)
+		} else {
+			m.include = append(m.include, r)
+		}
+	}
+
+	if len(m.include) == 0 {
+		return nil, fmt.Errorf("invalid status codes %q: only exclusions given", expr)
+	}
+
+	return m, nil
+}
+
+func parseStatusRange(token string) (statusRange, error) {
+	if token == "" {
+		return statusRange{}, fmt.Errorf("invalid status code: empty value")
+	}
+
+	lower := strings.ToLower(token)
+	if len(lower) == 3 && strings.HasSuffix(lower, "xx") {
+		class, err := strconv.Atoi(lower[:1])
+		if err != nil || class < 1 || class > 5 {
+			return statusRange{}, fmt.Errorf("invalid status class: %s", token)
+		}
+
+		return statusRange{from: class * 100, to: class*100 + 99}, nil
+	}
+
+	if from, to, ok := strings.Cut(token, "-"); ok {
+		start, err := parseStatusCode(from)
+		if err != nil {
+			return statusRange{}, err
+		}
+
+		end, err := parseStatusCode(to)
+		if err != nil {
+			return statusRange{}, err
+		}
+
+		if start > end {
+			return statusRange{}, fmt.Errorf("invalid status range: %s", token)
+		}
+
+		return statusRange{from: start, to: end}, nil
+	}
+
+	code, err := parseStatusCode(token)
+	if err != nil {
+		return statusRange{}, err
+	}
+
+	return statusRange{from: code, to: code}, nil
+}
+
+func parseStatusCode(value string) (int, error) {
+	value = strings.TrimSpace(value)
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid status code: %s", value)
+	}
+
+	if code < minStatusCode || code > maxStatusCode {
+		return 0, fmt.Errorf("status code out of range: %d", code)
+	}
+
+	return code, nil
+}
+
+// Match reports whether code is included and not excluded.
+func (m *StatusMatcher) Match(code int) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, r := range m.exclude {
+		if r.contains(code) {
+			return false
+		}
+	}
+
+	for _, r := range m.include {
+		if r.contains(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsEmpty reports whether the matcher can never match.
+func (m *StatusMatcher) IsEmpty() bool {
+	return m == nil || len(m.include) == 0
+}
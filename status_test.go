@@ -0,0 +1,99 @@
+package traefik_fallback_plugin_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestParseStatusMatcher(t *testing.T) {
+	cases := []struct {
+		name     string
+		expr     string
+		matches  []int
+		excludes []int
+	}{
+		{
+			name:     "empty",
+			expr:     "",
+			excludes: []int{200, 500},
+		},
+		{
+			name:     "single codes",
+			expr:     "500, 504",
+			matches:  []int{500, 504},
+			excludes: []int{501, 503},
+		},
+		{
+			name:     "range",
+			expr:     "500-503",
+			matches:  []int{500, 501, 503},
+			excludes: []int{499, 504},
+		},
+		{
+			name:     "class",
+			expr:     "5xx",
+			matches:  []int{500, 550, 599},
+			excludes: []int{499, 404},
+		},
+		{
+			name:     "class upper case",
+			expr:     "4XX",
+			matches:  []int{400, 404},
+			excludes: []int{500},
+		},
+		{
+			name:     "class with exclusion",
+			expr:     "5xx,!501",
+			matches:  []int{500, 502, 599},
+			excludes: []int{501, 404},
+		},
+		{
+			name:     "range exclusion",
+			expr:     "4xx,5xx,!400-403,!505",
+			matches:  []int{404, 500, 504},
+			excludes: []int{400, 403, 505, 200},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := traefik_fallback_plugin.ParseStatusMatcher(c.expr)
+			assert.NoError(t, err)
+
+			for _, code := range c.matches {
+				assert.True(t, m.Match(code), "expected %d to match", code)
+			}
+
+			for _, code := range c.excludes {
+				assert.False(t, m.Match(code), "expected %d not to match", code)
+			}
+		})
+	}
+}
+
+func TestParseStatusMatcherErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{name: "not a number", expr: "invalid", err: "invalid status code: invalid"},
+		{name: "empty token", expr: "500,,502", err: "invalid status code: empty value"},
+		{name: "out of range", expr: "600", err: "status code out of range: 600"},
+		{name: "bad class", expr: "6xx", err: "invalid status class: 6xx"},
+		{name: "reversed range", expr: "599-500", err: "invalid status range: 599-500"},
+		{name: "bad range bound", expr: "500-abc", err: "invalid status code: abc"},
+		{name: "only exclusions", expr: "!501", err: "only exclusions given"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := traefik_fallback_plugin.ParseStatusMatcher(c.expr)
+			assert.Nil(t, m)
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
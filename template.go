@@ -0,0 +1,186 @@
+package traefik_fallback_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	templateModeAuto = "auto"
+	templateModeHTML = "html"
+	templateModeText = "text"
+	templateModeJSON = "json"
+
+	defaultRequestIDHeader = "X-Request-Id"
+
+	// maxParsedTemplates bounds the parsed template cache, records are
+	// replaced on every refresh so old entries are simply dropped.
+	maxParsedTemplates = 64
+)
+
+// TemplateData is available to templated fallback bodies.
+type TemplateData struct {
+	Host       string
+	Path       string
+	Method     string
+	StatusCode int
+	TimedOut   bool
+	RequestID  string
+	Timestamp  time.Time
+}
+
+type bodyTemplate interface {
+	Execute(wr io.Writer, data interface{}) error
+}
+
+type parsedTemplateKey struct {
+	record *CacheRecord
+	html   bool
+}
+
+// bodyRenderer renders fallback bodies as Go templates, escaping for HTML
+// when the fallback is served as HTML and request values for JSON strings when
+// it is served as JSON.
+type bodyRenderer struct {
+	mode            string
+	requestIDHeader string
+
+	mu     sync.Mutex
+	parsed map[parsedTemplateKey]bodyTemplate
+}
+
+func newBodyRenderer(mode string, requestIDHeader string) (*bodyRenderer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case templateModeAuto, templateModeHTML, templateModeText, templateModeJSON:
+	default:
+		return nil, fmt.Errorf("invalid fallbackTemplate: %s", mode)
+	}
+
+	if requestIDHeader == "" {
+		requestIDHeader = defaultRequestIDHeader
+	}
+
+	return &bodyRenderer{
+		mode:            mode,
+		requestIDHeader: requestIDHeader,
+		parsed:          map[parsedTemplateKey]bodyTemplate{},
+	}, nil
+}
+
+func (r *bodyRenderer) render(rec *CacheRecord, contentType string, req *FetchRequest) ([]byte, error) {
+	escaping := r.escaping(contentType)
+
+	tmpl, err := r.template(rec, escaping == templateModeHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	data := TemplateData{
+		StatusCode: req.Outcome.StatusCode,
+		TimedOut:   req.Outcome.TimedOut,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	if req.Request != nil {
+		data.Host = req.Request.Host
+		data.Path = req.Request.URL.Path
+		data.Method = req.Request.Method
+		data.RequestID = req.Request.Header.Get(r.requestIDHeader)
+	}
+
+	if escaping == templateModeJSON {
+		data = data.jsonEscaped()
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// escaping returns the escaping mode for a fallback served as contentType.
+func (r *bodyRenderer) escaping(contentType string) string {
+	if r.mode != templateModeAuto {
+		return r.mode
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	switch {
+	case strings.Contains(mediaType, "html"):
+		return templateModeHTML
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return templateModeJSON
+	default:
+		return templateModeText
+	}
+}
+
+// jsonEscaped returns a copy with the client controlled values escaped for
+// use inside JSON strings, e.g. {"path":"{{.Path}}"}.
+func (d TemplateData) jsonEscaped() TemplateData {
+	d.Host = jsonStringContent(d.Host)
+	d.Path = jsonStringContent(d.Path)
+	d.Method = jsonStringContent(d.Method)
+	d.RequestID = jsonStringContent(d.RequestID)
+
+	return d
+}
+
+func jsonStringContent(value string) string {
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	return string(quoted[1 : len(quoted)-1])
+}
+
+func (r *bodyRenderer) template(rec *CacheRecord, html bool) (bodyTemplate, error) {
+	key := parsedTemplateKey{record: rec, html: html}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tmpl, ok := r.parsed[key]; ok {
+		return tmpl, nil
+	}
+
+	var (
+		tmpl bodyTemplate
+		err  error
+	)
+
+	if html {
+		tmpl, err = htmltemplate.New("fallback").Parse(string(rec.Body))
+	} else {
+		tmpl, err = texttemplate.New("fallback").Parse(string(rec.Body))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.parsed) >= maxParsedTemplates {
+		r.parsed = map[parsedTemplateKey]bodyTemplate{}
+	}
+
+	r.parsed[key] = tmpl
+
+	return tmpl, nil
+}
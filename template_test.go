@@ -0,0 +1,180 @@
+package traefik_fallback_plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestTemplatedFallback(t *testing.T) {
+	cases := []struct {
+		name        string
+		mode        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{
+			name:        "auto html escapes",
+			mode:        "auto",
+			contentType: "text/html; charset=utf-8",
+			body:        `<p>{{.Method}} {{.Path}} failed with {{.StatusCode}}, request {{.RequestID}}</p>`,
+			expected:    `<p>GET /a&lt;b&gt; failed with 503, request id-&lt;1&gt;</p>`,
+		},
+		{
+			name:        "auto text does not escape",
+			mode:        "auto",
+			contentType: "text/plain",
+			body:        `{{.Host}}{{.Path}} {{.RequestID}}`,
+			expected:    `shop.example.com/a<b> id-<1>`,
+		},
+		{
+			name:        "forced text",
+			mode:        "text",
+			contentType: "text/html",
+			body:        `{{.RequestID}}`,
+			expected:    `id-<1>`,
+		},
+		{
+			name:        "forced html",
+			mode:        "html",
+			contentType: "application/json",
+			body:        `{{.RequestID}}`,
+			expected:    `id-&lt;1&gt;`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+
+			fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "503",
+				FallbackBody:          c.body,
+				FallbackContentType:   c.contentType,
+				FallbackTemplate:      c.mode,
+				RequestIDHeader:       "X-Correlation-Id",
+			}, "test")
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://shop.example.com/a%3Cb%3E", nil)
+			req.Header.Set("X-Correlation-Id", "id-<1>")
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, c.expected, rec.Body.String())
+		})
+	}
+}
+
+func TestTemplatedFallbackParsesOnce(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "503",
+		FallbackURL:           "http://example.com",
+		FallbackTemplate:      "text",
+	}, "test")
+	assert.NoError(t, err)
+
+	record := &traefik_fallback_plugin.CacheRecord{
+		Body: []byte(`{{.Timestamp.Year}} {{.RequestID}}`),
+	}
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true).Times(2)
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(record, nil).Times(2)
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	for _, id := range []string{"first", "second"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-Id", id)
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		assert.Equal(t, time.Now().UTC().Format("2006")+" "+id, rec.Body.String())
+
+		// the parsed template is cached, changing the record body in place
+		// after the first render has no effect
+		record.Body = []byte("changed")
+	}
+}
+
+func TestTemplatedFallbackErrors(t *testing.T) {
+	_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), &traefik_fallback_plugin.Config{
+		FallbackTemplate: "xml",
+	}, "test")
+	assert.Error(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "503",
+		FallbackBody:          "{{.Broken",
+		FallbackTemplate:      "text",
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "Broken")
+}
+
+func TestTemplatedFallbackJSONEscaping(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for _, c := range []struct {
+		mode        string
+		contentType string
+	}{
+		{mode: "auto", contentType: "application/json"},
+		{mode: "auto", contentType: "application/problem+json; charset=utf-8"},
+		{mode: "json", contentType: "text/plain"},
+	} {
+		fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+			FallbackOnStatusCodes: "503",
+			FallbackBody:          `{"path":"{{.Path}}","host":"{{.Host}}","request":"{{.RequestID}}"}`,
+			FallbackContentType:   c.contentType,
+			FallbackTemplate:      c.mode,
+		}, "test")
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, `http://shop.example.com/a%22,%22admin%22:true,%22x%22:%22`, nil)
+		req.Header.Set("X-Request-Id", "id\"</script>\\")
+		rec := httptest.NewRecorder()
+
+		fallback.ServeHTTP(rec, req)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+		assert.Equal(t, map[string]interface{}{
+			"path":    `/a","admin":true,"x":"`,
+			"host":    "shop.example.com",
+			"request": "id\"</script>\\",
+		}, body, c.contentType)
+		assert.NotContains(t, rec.Body.String(), "</script>")
+	}
+}
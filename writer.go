@@ -0,0 +1,212 @@
+package traefik_fallback_plugin
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+type writerState int
+
+const (
+	writerPending writerState = iota
+	writerBuffering
+	writerPassthrough
+	writerDiscard
+)
+
+const (
+	overflowPassthrough = "passthrough"
+	overflowFallback    = "fallback"
+)
+
+// upstreamWriter holds the upstream response back only until its status code
+// is known. Responses that do not trigger the fallback are streamed straight
+// to the client, the others are discarded.
+//
+// With a positive maxBuffered the body of a non-fallback response is buffered
+// up to that many bytes, so the upstream timeout covers the whole response.
+// Once the limit is exceeded the buffer is either flushed and the rest
+// streamed, or discarded in favour of the fallback.
+type upstreamWriter struct {
+	rw               http.ResponseWriter
+	header           http.Header
+	isFallback       func(code int) bool
+	decided          chan struct{}
+	maxBuffered      int64
+	overflowFallback bool
+
+	mu         sync.Mutex
+	state      writerState
+	code       int
+	buffer     bytes.Buffer
+	panicked   bool
+	panicValue interface{}
+}
+
+func newUpstreamWriter(
+	rw http.ResponseWriter,
+	isFallback func(code int) bool,
+	maxBuffered int64,
+	overflowFallback bool,
+) *upstreamWriter {
+	return &upstreamWriter{
+		rw:               rw,
+		header:           make(http.Header),
+		isFallback:       isFallback,
+		decided:          make(chan struct{}),
+		maxBuffered:      maxBuffered,
+		overflowFallback: overflowFallback,
+	}
+}
+
+func (w *upstreamWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == writerPassthrough {
+		return w.rw.Header()
+	}
+
+	return w.header
+}
+
+func (w *upstreamWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeHeaderLocked(code)
+}
+
+func (w *upstreamWriter) writeHeaderLocked(code int) {
+	if w.state != writerPending {
+		return
+	}
+
+	if code >= 100 && code < 200 { // informational responses do not decide anything
+		return
+	}
+
+	w.code = code
+
+	switch {
+	case w.isFallback(code):
+		w.state = writerDiscard
+		close(w.decided)
+	case w.maxBuffered > 0:
+		w.state = writerBuffering
+	default:
+		w.commitLocked()
+	}
+}
+
+// commitLocked sends the status, headers and anything buffered so far to the
+// client and switches to streaming.
+func (w *upstreamWriter) commitLocked() {
+	dst := w.rw.Header()
+	for name, values := range w.header {
+		dst[name] = values
+	}
+
+	w.rw.WriteHeader(w.code)
+	w.state = writerPassthrough
+
+	if w.buffer.Len() > 0 {
+		_, _ = w.rw.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+
+	close(w.decided)
+}
+
+func (w *upstreamWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeHeaderLocked(http.StatusOK)
+
+	if w.state == writerBuffering {
+		if int64(w.buffer.Len()+len(b)) <= w.maxBuffered {
+			return w.buffer.Write(b)
+		}
+
+		if w.overflowFallback {
+			w.state = writerDiscard
+			w.buffer.Reset()
+			close(w.decided)
+		} else {
+			w.commitLocked()
+		}
+	}
+
+	if w.state != writerPassthrough {
+		return len(b), nil
+	}
+
+	return w.rw.Write(b)
+}
+
+// Flush implements http.Flusher and forwards to the client once the response
+// is being streamed.
+func (w *upstreamWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeHeaderLocked(http.StatusOK)
+
+	if w.state != writerPassthrough {
+		return
+	}
+
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish commits the implicit 200 of a handler that returned without writing
+// and releases a fully buffered response.
+func (w *upstreamWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeHeaderLocked(http.StatusOK)
+
+	if w.state == writerBuffering {
+		w.commitLocked()
+	}
+}
+
+// abandon discards any further upstream output unless the response is already
+// being streamed, and returns the resulting state.
+func (w *upstreamWriter) abandon() writerState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == writerPending || w.state == writerBuffering {
+		w.state = writerDiscard
+		w.buffer.Reset()
+		close(w.decided)
+	}
+
+	return w.state
+}
+
+func (w *upstreamWriter) recordPanic(value interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.panicked = true
+	w.panicValue = value
+}
+
+func (w *upstreamWriter) outcome(timedOut bool) UpstreamOutcome {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return UpstreamOutcome{
+		StatusCode: w.code,
+		TimedOut:   timedOut,
+		Panicked:   w.panicked,
+		PanicValue: w.panicValue,
+	}
+}
@@ -0,0 +1,211 @@
+package traefik_fallback_plugin_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	traefik_fallback_plugin "github.com/skynet2/traefik-fallback-plugin"
+)
+
+func TestStreamingPassthrough(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		_, _ = w.Write([]byte("data: first\n"))
+		w.(http.Flusher).Flush()
+
+		<-release
+		time.Sleep(100 * time.Millisecond) // outlive the upstream timeout
+
+		_, _ = w.Write([]byte("data: second\n"))
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+		UpstreamTimeout:       "50ms",
+	}, "test")
+	assert.NoError(t, err)
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true)
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	srv := httptest.NewServer(fallback)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: first\n", line) // received before the handler finished
+
+	close(release)
+
+	rest, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "data: second\n", string(rest))
+}
+
+func TestStreamingDiscardsFallbackBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "1")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("upstream error"))
+		w.(http.Flusher).Flush()
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+	}, "test")
+	assert.NoError(t, err)
+
+	fetcher := NewMockFetcher(gomock.NewController(t))
+	fetcher.EXPECT().CanFetch().Return(true)
+	fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+		Body: []byte("fallback"),
+	}, nil)
+	fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "fallback", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("X-Upstream"))
+	assert.False(t, rec.Flushed)
+}
+
+func TestStreamingImplicitStatus(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "1")
+		_, _ = w.Write([]byte("implicit"))
+	})
+
+	fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+		FallbackOnStatusCodes: "5xx",
+		FallbackURL:           "http://example.com",
+	}, "test")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	fallback.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "implicit", rec.Body.String())
+	assert.Equal(t, "1", rec.Header().Get("X-Upstream"))
+}
+
+func TestBufferedUpstream(t *testing.T) {
+	cases := []struct {
+		name           string
+		maxSize        string
+		overflowAction string
+		delay          time.Duration
+		code           int
+		body           string
+	}{
+		{
+			name:    "fits into buffer",
+			maxSize: "1024",
+			code:    http.StatusOK,
+			body:    "0123456789abcdef",
+		},
+		{
+			name:    "timeout while buffering serves fallback",
+			maxSize: "1024",
+			delay:   200 * time.Millisecond,
+			code:    http.StatusAccepted,
+			body:    "fallback",
+		},
+		{
+			name:    "overflow streams the rest",
+			maxSize: "10",
+			delay:   200 * time.Millisecond,
+			code:    http.StatusOK,
+			body:    "0123456789abcdef",
+		},
+		{
+			name:           "overflow serves fallback",
+			maxSize:        "10",
+			overflowAction: "fallback",
+			code:           http.StatusAccepted,
+			body:           "fallback",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("01234567"))
+				_, _ = w.Write([]byte("89abcdef"))
+				time.Sleep(c.delay)
+			})
+
+			fallback, err := traefik_fallback_plugin.New(context.Background(), handler, &traefik_fallback_plugin.Config{
+				FallbackOnStatusCodes: "5xx",
+				FallbackURL:           "http://example.com",
+				FallbackStatusCode:    "202",
+				UpstreamTimeout:       "50ms",
+				MaxBufferedBodySize:   c.maxSize,
+				BufferOverflowAction:  c.overflowAction,
+			}, "test")
+			assert.NoError(t, err)
+
+			fetcher := NewMockFetcher(gomock.NewController(t))
+			fetcher.EXPECT().CanFetch().Return(true)
+			fetcher.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(&traefik_fallback_plugin.CacheRecord{
+				Body: []byte("fallback"),
+			}, nil).AnyTimes()
+			fallback.(*traefik_fallback_plugin.Fallback).SetFetcher(fetcher)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+
+			fallback.ServeHTTP(rec, req)
+
+			assert.Equal(t, c.code, rec.Code)
+			assert.Equal(t, c.body, rec.Body.String())
+		})
+	}
+}
+
+func TestBufferedUpstreamInvalidConfig(t *testing.T) {
+	for _, config := range []*traefik_fallback_plugin.Config{
+		{MaxBufferedBodySize: "abc"},
+		{MaxBufferedBodySize: "-1"},
+		{BufferOverflowAction: "drop"},
+	} {
+		_, err := traefik_fallback_plugin.New(context.Background(), http.NotFoundHandler(), config, "test")
+		assert.Error(t, err)
+	}
+}